@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfig sets the flags named by the keys of the yaml file at path to
+// their values, leaving alone those set on the command line so they take
+// precedence. Lists, like allowed-hosts, may be given as yaml sequences, as
+// may the values of flags that can be repeated, like cookie.
+func loadConfig(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file map[string]yaml.Node
+	if err = yaml.Unmarshal(b, &file); err != nil {
+		return fmt.Errorf("can't parse config %s: %v", path, err)
+	}
+
+	var unknown []string
+	for k := range file {
+		if k == "config" || flag.Lookup(k) == nil {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown keys in config %s: %s", path, strings.Join(unknown, ", "))
+	}
+
+	for k, n := range file {
+		if isFlagSet(k) {
+			continue
+		}
+		if _, ok := flag.Lookup(k).Value.(*repeated); ok && n.Kind == yaml.SequenceNode {
+			// set repeated flags once per element, their values may hold commas
+			for _, c := range n.Content {
+				v, err := configValue(*c)
+				if err != nil {
+					return fmt.Errorf("%s in config %s: %v", k, path, err)
+				}
+				flag.Set(k, v)
+			}
+			continue
+		}
+		v, err := configValue(n)
+		if err != nil {
+			return fmt.Errorf("%s in config %s: %v", k, path, err)
+		}
+		if err = flag.Set(k, v); err != nil {
+			return fmt.Errorf("%s in config %s: %v", k, path, err)
+		}
+	}
+	return nil
+}
+
+// configValue returns the value of n as it'd be passed on the command line.
+func configValue(n yaml.Node) (string, error) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return n.Value, nil
+	case yaml.SequenceNode:
+		vals := make([]string, 0, len(n.Content))
+		for _, c := range n.Content {
+			if c.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("line %d: lists can only hold plain values", c.Line)
+			}
+			vals = append(vals, c.Value)
+		}
+		return strings.Join(vals, ","), nil
+	default:
+		return "", fmt.Errorf("line %d: not a plain value or list", n.Line)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withFlags has the command line flags be a fresh set of a few of those of
+// main for the test, parsed from args.
+func withFlags(t *testing.T, args ...string) (cnumber *int, repurl *string, hosts *string, cookies *repeated) {
+	t.Helper()
+	prev := flag.CommandLine
+	flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+	t.Cleanup(func() { flag.CommandLine = prev })
+
+	cnumber = flag.Int("cnumber", 10, "")
+	repurl = flag.String("repurl", "https://chromium.googlesource.com/chromiumos/platform/tast-tests/", "")
+	hosts = flag.String("allowed-hosts", "*.googlesource.com,github.com", "")
+	cookies = &repeated{}
+	flag.Var(cookies, "cookie", "")
+	flag.String("config", "", "")
+	if err := flag.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cnumber, repurl, hosts, cookies
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestFile(t, path, `cnumber: 500
+repurl: https://chromium.googlesource.com/chromium/src
+allowed-hosts: [chromium.googlesource.com, "*.corp.example.com"]
+cookie:
+  - SID=a,b
+  - HSID=c
+`)
+	cnumber, repurl, hosts, cookies := withFlags(t, "-cnumber", "20")
+	if err := loadConfig(path); err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if *cnumber != 20 {
+		t.Errorf("cnumber = %d, want the 20 of the command line over the config's", *cnumber)
+	}
+	if *repurl != "https://chromium.googlesource.com/chromium/src" {
+		t.Errorf("repurl = %q, want the config's", *repurl)
+	}
+	if *hosts != "chromium.googlesource.com,*.corp.example.com" {
+		t.Errorf("allowed-hosts = %q, want the list of the config joined", *hosts)
+	}
+	if got := strings.Join(*cookies, " "); got != "SID=a,b HSID=c" {
+		t.Errorf("cookies = %q, want each element of the config", got)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, config, want string
+	}{
+		{"unknown keys", "cnumber: 5\nrepo-url: x\nbrnach: main\n", "unknown keys in config"},
+		{"config itself", "config: other.yaml\n", "unknown keys in config"},
+		{"bad value", "cnumber: lots\n", "cnumber in config"},
+		{"nested", "repurl:\n  host: chromium.googlesource.com\n", "not a plain value or list"},
+		{"not yaml", "cnumber: [5\n", "can't parse config"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			writeTestFile(t, path, tc.config)
+			withFlags(t)
+			err := loadConfig(path)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("loadConfig = %v, want an error containing %q", err, tc.want)
+			}
+			if tc.name == "unknown keys" && err != nil && !strings.Contains(err.Error(), "brnach, repo-url") {
+				t.Errorf("error %q doesn't list the unknown keys in order", err)
+			}
+		})
+	}
+}
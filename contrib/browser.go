@@ -0,0 +1,500 @@
+package contrib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mafredri/cdp"
+	"github.com/mafredri/cdp/devtool"
+	"github.com/mafredri/cdp/protocol/dom"
+	"github.com/mafredri/cdp/protocol/emulation"
+	"github.com/mafredri/cdp/protocol/network"
+	"github.com/mafredri/cdp/protocol/page"
+	"github.com/mafredri/cdp/rpcc"
+	"golang.org/x/net/html"
+)
+
+const tabCloseTimeout = 5 * time.Second
+
+// maxReconnects is how many times in a row a tab redials the browser after
+// losing its connection before giving up.
+const maxReconnects = 3
+
+// errBrowserLost is returned once a tab gave up redialing the browser.
+var errBrowserLost = errors.New("lost the connection to the browser")
+
+// browser is a browser driven over the devtools protocol, and the tabs used
+// in it.
+type browser struct {
+	devt *devtool.DevTools
+	stop func()
+	tabs []*tab
+	// stopWorkers, if set, stops what's still using the tabs.
+	stopWorkers func()
+}
+
+// tab is a single page target of the browser.
+type tab struct {
+	pt      *devtool.Target
+	created bool
+	conn    *rpcc.Conn
+	c       *cdp.Client
+	// loaded tells when the pages navigated to are loaded.
+	loaded pageLoad
+	// shot is the screenshot of the last page navigated to, if taken.
+	shot []byte
+	// reconnects counts the times the connection was dialed again since
+	// the last page loaded.
+	reconnects int
+}
+
+// openBrowser connects to the browser of opts, launching it first if asked,
+// and readies a tab for navigation.
+func openBrowser(ctx context.Context, opts Options) (b *browser, err error) {
+	b = &browser{}
+	defer func() {
+		if err != nil {
+			b.close()
+		}
+	}()
+
+	if opts.Launch {
+		if b.stop, err = launchChrome(ctx, opts.DevTools); err != nil {
+			return nil, err
+		}
+	}
+
+	b.devt = devtool.New(opts.DevTools)
+	t := &tab{}
+	if !opts.NewTab {
+		t.pt, err = b.devt.Get(ctx, devtool.Page)
+	}
+	if opts.NewTab || err != nil {
+		t.pt, err = b.devt.Create(ctx)
+		if err != nil {
+			return nil, err
+		}
+		t.created = true
+	}
+	b.tabs = append(b.tabs, t)
+	if err = t.connect(ctx, opts); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// openTab opens one more tab for navigation.
+func (b *browser) openTab(ctx context.Context, opts Options) (*tab, error) {
+	pt, err := b.devt.Create(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t := &tab{pt: pt, created: true}
+	b.tabs = append(b.tabs, t)
+	return t, t.connect(ctx, opts)
+}
+
+// connect readies t for navigation, with the user agent and the page load
+// event opts asks for.
+func (t *tab) connect(ctx context.Context, opts Options) error {
+	var err error
+	t.conn, err = rpcc.DialContext(ctx, t.pt.WebSocketDebuggerURL)
+	if err != nil {
+		return err
+	}
+
+	t.c = cdp.NewClient(t.conn)
+
+	if err = setAuth(ctx, t.c, opts); err != nil {
+		return err
+	}
+	if opts.UserAgent != "" {
+		if err = t.c.Emulation.SetUserAgentOverride(ctx, emulation.NewSetUserAgentOverrideArgs(opts.UserAgent)); err != nil {
+			return fmt.Errorf("can't set user agent: %v", err)
+		}
+	}
+
+	if err = t.c.Page.Enable(ctx); err != nil {
+		return err
+	}
+	t.loaded, err = subscribeLoad(ctx, t.c, opts.WaitFor)
+	return err
+}
+
+// setAuth has the tab send the cookies and headers of opts.
+func setAuth(ctx context.Context, c *cdp.Client, opts Options) error {
+	if len(opts.Cookies) == 0 && len(opts.Headers) == 0 {
+		return nil
+	}
+	if err := c.Network.Enable(ctx, network.NewEnableArgs()); err != nil {
+		return err
+	}
+	if len(opts.Cookies) > 0 {
+		cookies := make([]network.CookieParam, 0, len(opts.Cookies))
+		for name, value := range opts.Cookies {
+			repurl, root := opts.RepoURL, "/"
+			cookies = append(cookies, network.CookieParam{Name: name, Value: value, URL: &repurl, Path: &root})
+		}
+		if err := c.Network.SetCookies(ctx, network.NewSetCookiesArgs(cookies)); err != nil {
+			return fmt.Errorf("can't set cookies: %v", err)
+		}
+	}
+	if len(opts.Headers) > 0 {
+		h, err := json.Marshal(opts.Headers)
+		if err != nil {
+			return err
+		}
+		if err = c.Network.SetExtraHTTPHeaders(ctx, network.NewSetExtraHTTPHeadersArgs(h)); err != nil {
+			return fmt.Errorf("can't set headers: %v", err)
+		}
+	}
+	return nil
+}
+
+// ensureConnected dials t again if its connection to the browser dropped,
+// so the pages after it are still fetched.
+func (t *tab) ensureConnected(ctx context.Context, opts Options) error {
+	if t.conn != nil && t.conn.Context().Err() == nil {
+		return nil
+	}
+	if t.reconnects >= maxReconnects {
+		return fmt.Errorf("%w %d times, giving up", errBrowserLost, t.reconnects+1)
+	}
+	t.reconnects++
+	slog.Warn("reconnecting to the browser", "attempt", t.reconnects)
+	if t.loaded != nil {
+		t.loaded.close()
+		t.loaded = nil
+	}
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+	return t.connect(ctx, opts)
+}
+
+// close releases what openBrowser and openTab got hold of: tabs only if they
+// were opened for us, and the browser only if it was launched for us.
+func (b *browser) close() {
+	if b.stopWorkers != nil {
+		b.stopWorkers()
+	}
+	for _, t := range b.tabs {
+		if t.loaded != nil {
+			t.loaded.close()
+		}
+		if t.conn != nil {
+			t.conn.Close()
+		}
+		if t.created {
+			// ctx may be done by now
+			cctx, cancel := context.WithTimeout(context.Background(), tabCloseTimeout)
+			b.devt.Close(cctx, t.pt)
+			cancel()
+		}
+	}
+	if b.stop != nil {
+		b.stop()
+	}
+}
+
+// fetcher returns the func fetching pages in t, retried, rate limited by lim
+// and cached as opts asks.
+func (t *tab) fetcher(ctx context.Context, opts Options, lim *limiter) fetchFunc {
+	fetchPage := withRetry(ctx, withRate(func(url string) (string, error) {
+		pctx := ctx
+		if opts.PageTimeout > 0 {
+			var cancel context.CancelFunc
+			pctx, cancel = context.WithTimeout(ctx, opts.PageTimeout)
+			defer cancel()
+		}
+		t.shot = nil
+		if err := t.ensureConnected(ctx, opts); err != nil {
+			return "", err
+		}
+		r, err := fetchLink(t.c, pctx, t.loaded, url, opts.WaitSelector, opts.WaitTimeout)
+		if err == nil {
+			t.reconnects = 0
+		}
+		if err == nil && isThrottlePage(r) {
+			return "", &throttledError{url: url}
+		}
+		if err == nil && opts.ScreenshotDir != "" {
+			// a missing screenshot isn't worth failing the page for
+			s, err := t.c.Page.CaptureScreenshot(pctx, page.NewCaptureScreenshotArgs().SetFormat("png"))
+			if err != nil {
+				slog.Warn("can't capture screenshot", "url", url, "err", err)
+			} else {
+				t.shot = s.Data
+			}
+		}
+		return r, err
+	}, lim), opts.Retries)
+	if opts.CacheDir != "" {
+		fetchPage = withCache(fetchPage, opts.CacheDir, opts.Refresh)
+	}
+	return parsed(fetchPage)
+}
+
+// parsed returns fetchPage parsing the pages it fetches.
+func parsed(fetchPage pageFunc) fetchFunc {
+	return func(url string) (*html.Node, error) {
+		r, err := fetchPage(url)
+		if err != nil {
+			return nil, err
+		}
+		return html.Parse(strings.NewReader(r))
+	}
+}
+
+// newWalker returns the walker of the history opts selects through the pages
+// fetch gets, and the source reading them. The walk starts at the commit
+// start, or at the tip of the branch if it's empty.
+func newWalker(opts Options, fetch fetchFunc, start string) (commitWalker, Source, error) {
+	src := opts.Source
+	if src == nil {
+		var err error
+		if src, err = SourceFor("", opts.RepoURL); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// walk from the commit itself, so the walk doesn't depend on what the
+	// pages of the branch look like nor move along with it
+	first := start
+	if first == "" {
+		var err error
+		if first, err = tipCommit(opts, src, fetch); err != nil {
+			return nil, nil, err
+		}
+	}
+	link, err := src.CommitLink(opts.RepoURL, first)
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.Info("walking history", "branch", opts.Branch, "commit", first, "from", link, "resumed", start != "")
+
+	// prefer reading a log listing, walking parents is the fallback
+	if ls, ok := src.(logSource); ok {
+		w, err := ls.newLogWalker(fetch, opts.RepoURL, link, opts.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if w != nil {
+			if lw, ok := w.(*logWalker); ok {
+				lw.commitPages = opts.CommitPages || opts.IncludePath != ""
+			}
+			return w, src, nil
+		}
+	}
+	if opts.Path != "" {
+		return nil, nil, fmt.Errorf("can't walk the history of %s without a log listing of it", opts.Path)
+	}
+	return &parentWalker{fetch: fetch, src: src, repurl: opts.RepoURL, link: link}, src, nil
+}
+
+// tipCommit resolves the branch to the hash of the commit at its tip. The
+// link a source spells out for the branch is tried first, the repository page
+// is only searched for one when that doesn't lead to a commit page. A full
+// commit hash is its own tip.
+func tipCommit(opts Options, src Source, fetch fetchFunc) (string, error) {
+	if fullHash.MatchString(opts.Branch) {
+		return opts.Branch, nil
+	}
+	if rs, ok := src.(refSource); ok {
+		link, err := rs.RefLink(opts.RepoURL, opts.Branch)
+		if err != nil {
+			return "", err
+		}
+		p, err := fetch(link)
+		if err == nil {
+			var hash string
+			if hash, err = refCommitHash(src, p, opts.RepoURL, fetch); err == nil {
+				return hash, nil
+			}
+		}
+		slog.Debug("branch link isn't a commit page, looking for it in the repository page", "link", link, "err", err)
+	}
+
+	m, err := fetch(opts.RepoURL)
+	if err != nil {
+		return "", err
+	}
+	link, err := src.MainLink(m, opts.RepoURL, opts.Branch)
+	if err != nil {
+		return "", err
+	}
+	p, err := fetch(link)
+	if err != nil {
+		return "", err
+	}
+	return refCommitHash(src, p, opts.RepoURL, fetch)
+}
+
+// refCommitHash returns the hash of the commit of the page of a ref, that of
+// the commit an annotated tag links to if it's the page of one.
+func refCommitHash(src Source, doc *html.Node, repurl string, fetch fetchFunc) (string, error) {
+	hash, err := src.CommitHash(doc)
+	ts, ok := src.(tagSource)
+	if err == nil || !ok {
+		return hash, err
+	}
+	link, terr := ts.TagObjectLink(doc, repurl)
+	if terr != nil {
+		return "", err
+	}
+	p, err := fetch(link)
+	if err != nil {
+		return "", err
+	}
+	return src.CommitHash(p)
+}
+
+// commits returns the commits of the history opts selects from start on, read
+// from the pages the browser navigates to.
+func (b *browser) commits(ctx context.Context, opts Options, start string) (commitIter, error) {
+	lim := newLimiter(ctx, opts.Rate)
+	walker, src, err := newWalker(opts, b.tabs[0].fetcher(ctx, opts, lim), start)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ScreenshotDir != "" {
+		if err = os.MkdirAll(opts.ScreenshotDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	shots := &shotSaver{dir: opts.ScreenshotDir}
+
+	if opts.Concurrency > 1 {
+		if lw, ok := walker.(*logWalker); ok {
+			return b.poolCommits(ctx, opts, lim, lw, src, shots)
+		}
+		slog.Warn("concurrency needs a log listing, fetching one commit at a time")
+	}
+	return &pageCommits{walker: walker, src: src, t: b.tabs[0], shots: shots}, nil
+}
+
+// pageCommits parses the commit pages a walker yields.
+type pageCommits struct {
+	walker commitWalker
+	src    Source
+	// t is the tab the walker navigates in, if any, whose screenshots go to
+	// shots.
+	t     *tab
+	shots *shotSaver
+}
+
+func (p *pageCommits) next() (CommitRecord, error) {
+	doc, url, err := p.walker.next()
+	if err != nil {
+		return CommitRecord{}, err
+	}
+	cmt, perr := parsePage(p.src, doc, url)
+	if p.t != nil {
+		err = p.shots.save(cmt.Hash, p.t.shot)
+		p.t.shot = nil
+		if err != nil {
+			return cmt, err
+		}
+	}
+	return cmt, perr
+}
+
+// shotSaver saves the screenshots of the pages commits are read from.
+type shotSaver struct {
+	dir      string
+	unparsed int
+}
+
+// save writes shot as <hash>.png, or unparsed-<n>.png when even the hash
+// couldn't be read. Pages served from the cache or already saved have no
+// shot.
+func (s *shotSaver) save(hash string, shot []byte) error {
+	if s.dir == "" || shot == nil {
+		return nil
+	}
+	name := hash
+	if name == "" {
+		s.unparsed++
+		name = fmt.Sprintf("unparsed-%d", s.unparsed)
+	}
+	return writeFile(filepath.Join(s.dir, name+".png"), shot, 0644)
+}
+
+// selectorPollInterval is how often the page is checked for the element
+// fetchLink waits for.
+const selectorPollInterval = 100 * time.Millisecond
+
+// fetchLink navigates to url and returns the html of the page once its DOM
+// content is loaded and, if selector isn't empty, an element matching
+// selector shows up. Pages short of such an element after wait are returned as
+// they are, not every page walked has one.
+func fetchLink(c *cdp.Client, ctx context.Context, loaded pageLoad, url, selector string, wait time.Duration) (string, error) {
+	if err := loaded.drain(); err != nil {
+		return "", err
+	}
+
+	navArgs := page.NewNavigateArgs(url)
+	nav, err := c.Page.Navigate(ctx, navArgs)
+	if err != nil {
+		return "", err
+	}
+
+	if err = loaded.wait(ctx, nav); err != nil {
+		return "", err
+	}
+	if nav.ErrorText != nil {
+		return "", &navigationError{url: url, text: *nav.ErrorText}
+	}
+
+	doc, err := c.DOM.GetDocument(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	if selector != "" {
+		if err = waitSelector(ctx, c, doc.Root.NodeID, selector, wait); err != nil {
+			return "", err
+		}
+	}
+
+	result, err := c.DOM.GetOuterHTML(ctx, &dom.GetOuterHTMLArgs{
+		NodeID: &doc.Root.NodeID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.OuterHTML, nil
+}
+
+// waitSelector polls the document under root until an element matches
+// selector or wait passes, only failing if ctx is done.
+func waitSelector(ctx context.Context, c *cdp.Client, root dom.NodeID, selector string, wait time.Duration) error {
+	deadline := time.Now().Add(wait)
+	for {
+		r, err := c.DOM.QuerySelector(ctx, dom.NewQuerySelectorArgs(root, selector))
+		if err != nil {
+			return err
+		}
+		if r.NodeID != 0 {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			slog.Debug("selector not found", "selector", selector, "wait", wait)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(selectorPollInterval):
+		}
+	}
+}
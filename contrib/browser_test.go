@@ -0,0 +1,873 @@
+package contrib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mafredri/cdp/devtool"
+)
+
+// notFoundPage is what the fake browser shows for urls it has no page of,
+// like gitiles does.
+const notFoundPage = `<html><head><title>Not Found</title></head><body>Not Found</body></html>`
+
+// emptyPage is what the fake browser shows of pages whose content is yet to
+// arrive.
+const emptyPage = `<html><head></head><body></body></html>`
+
+// fakeDevTools is a browser answering the devtools protocol with saved pages,
+// enough of it for Scrape to walk them.
+type fakeDevTools struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// pages are the pages by url.
+	pages map[string]string
+	// hang counts the loads of a url left to never finish.
+	hang map[string]int
+	// drop counts the navigations to a url left to drop the connection at.
+	drop map[string]int
+	// before are the pages shown at a url ahead of its own, one per
+	// navigation, like those of a server throttling us.
+	before map[string][]string
+	// fires are the load events fired for a page, like
+	// "Page.loadEventFired", all of them if nil.
+	fires []string
+	// selectorAfter is how many times a page is queried for a selector
+	// before an element matches. Until then the page is shown empty, its
+	// content arriving late.
+	selectorAfter int
+	// calls are the methods called, in order.
+	calls []fakeCall
+	// navigated are the urls navigated to, in order.
+	navigated []string
+	// dials counts the connections to tabs.
+	dials int
+	tabs  int
+}
+
+type fakeCall struct {
+	method string
+	params json.RawMessage
+}
+
+// newFakeDevTools starts a fake browser, stopped once t ends.
+func newFakeDevTools(t testing.TB) *fakeDevTools {
+	f := &fakeDevTools{pages: make(map[string]string), hang: make(map[string]int), drop: make(map[string]int),
+		before: make(map[string][]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/json/version", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Browser": "Fake/1.0"}`)
+	})
+	mux.HandleFunc("/json/list", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*devtool.Target{f.target("t0")})
+	})
+	mux.HandleFunc("/json/new", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.tabs++
+		id := fmt.Sprint("t", f.tabs)
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(f.target(id))
+	})
+	mux.HandleFunc("/json/close/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Target is closing")
+	})
+	upgrader := websocket.Upgrader{}
+	mux.HandleFunc("/devtools/page/", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.dials++
+		f.mu.Unlock()
+		f.serve(conn)
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeDevTools) target(id string) *devtool.Target {
+	return &devtool.Target{ID: id, Type: devtool.Page, URL: "about:blank",
+		WebSocketDebuggerURL: "ws://" + f.Listener.Addr().String() + "/devtools/page/" + id}
+}
+
+// addCommits serves the commit pages of cmts, the first one at the tip of
+// main.
+func (f *fakeDevTools) addCommits(cmts ...testCommit) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, c := range cmts {
+		if i == 0 {
+			f.pages[testRepo+"/+/refs/heads/main"] = commitPage(c)
+		}
+		f.pages[testRepo+"/+/"+c.hash] = commitPage(c)
+	}
+}
+
+// addLog serves the log listing of cmts, newest first, perPage commits a
+// page.
+func (f *fakeDevTools) addLog(cmts []testCommit, perPage int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	page := testRepo + "/+log/" + cmts[0].hash + "?pretty=full"
+	for i := 0; i < len(cmts); i += perPage {
+		end, next := i+perPage, ""
+		if end < len(cmts) {
+			next = "/chromiumos/platform/tast-tests/+log/" + cmts[0].hash + "?pretty=full&s=" + cmts[end].hash
+		} else {
+			end = len(cmts)
+		}
+		f.pages[page] = logPage(cmts[i:end], next)
+		page = "https://chromium.googlesource.com" + next
+	}
+}
+
+// options returns the options scraping the pages of f.
+func (f *fakeDevTools) options() Options {
+	return Options{DevTools: f.URL, RepoURL: testRepo, Branch: "main", Source: Gitiles, Count: 100}
+}
+
+// called returns the params of the calls of method.
+func (f *fakeDevTools) called(method string) []json.RawMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var params []json.RawMessage
+	for _, c := range f.calls {
+		if c.method == method {
+			params = append(params, c.params)
+		}
+	}
+	return params
+}
+
+// navigations returns how many times url was navigated to.
+func (f *fakeDevTools) navigations(url string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, u := range f.navigated {
+		if u == url {
+			n++
+		}
+	}
+	return n
+}
+
+// late reports whether the content of a page queried polls times for a
+// selector is yet to arrive.
+func (f *fakeDevTools) late(polls int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.selectorAfter > 0 && polls <= f.selectorAfter
+}
+
+// serve answers the calls made over conn, the connection of a tab, until
+// it's closed.
+func (f *fakeDevTools) serve(conn *websocket.Conn) {
+	defer conn.Close()
+	var cur string
+	loads, polls := 0, 0
+	lifecycle := false
+	for {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req struct {
+			ID     int64           `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err = json.Unmarshal(b, &req); err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.calls = append(f.calls, fakeCall{req.Method, req.Params})
+		f.mu.Unlock()
+
+		var result interface{} = struct{}{}
+		var events []interface{}
+		event := func(method string, params interface{}) {
+			events = append(events, map[string]interface{}{"method": method, "params": params})
+		}
+		switch req.Method {
+		case "Page.navigate":
+			var p struct {
+				URL string `json:"url"`
+			}
+			json.Unmarshal(req.Params, &p)
+			f.mu.Lock()
+			f.navigated = append(f.navigated, p.URL)
+			drop, hang := f.drop[p.URL] > 0, f.hang[p.URL] > 0
+			if drop {
+				f.drop[p.URL]--
+			} else if hang {
+				f.hang[p.URL]--
+			}
+			page, ok := f.pages[p.URL]
+			fires := f.fires
+			if b := f.before[p.URL]; len(b) > 0 && !drop {
+				page, ok = b[0], true
+				f.before[p.URL] = b[1:]
+			}
+			f.mu.Unlock()
+			if drop {
+				return
+			}
+			if !ok {
+				page = notFoundPage
+			}
+			cur, polls = page, 0
+			loads++
+			loader := fmt.Sprint("loader-", loads)
+			result = map[string]string{"frameId": "main", "loaderId": loader}
+			if hang {
+				break
+			}
+			fired := func(method string) bool { return fires == nil || containsString(fires, method) }
+			if fired("Page.domContentEventFired") {
+				event("Page.domContentEventFired", map[string]float64{"timestamp": 1})
+			}
+			if fired("Page.loadEventFired") {
+				event("Page.loadEventFired", map[string]float64{"timestamp": 2})
+			}
+			if lifecycle && fired("Page.lifecycleEvent") {
+				// only the last one tells the page navigated to is idle
+				event("Page.lifecycleEvent", map[string]interface{}{"frameId": "ad", "loaderId": "other", "name": "networkIdle", "timestamp": 3})
+				event("Page.lifecycleEvent", map[string]interface{}{"frameId": "main", "loaderId": loader, "name": "load", "timestamp": 3})
+				event("Page.lifecycleEvent", map[string]interface{}{"frameId": "main", "loaderId": loader, "name": "networkIdle", "timestamp": 4})
+			}
+		case "Page.setLifecycleEventsEnabled":
+			lifecycle = true
+		case "Page.captureScreenshot":
+			result = map[string][]byte{"data": []byte("\x89PNG")}
+		case "DOM.getDocument":
+			result = map[string]interface{}{"root": map[string]interface{}{
+				"nodeId": 1, "backendNodeId": 1, "nodeType": 9, "nodeName": "#document"}}
+		case "DOM.querySelector":
+			polls++
+			id := 0
+			if !f.late(polls) {
+				id = 2
+			}
+			result = map[string]int{"nodeId": id}
+		case "DOM.getOuterHTML":
+			html := cur
+			if f.late(polls) {
+				html = emptyPage
+			}
+			result = map[string]string{"outerHTML": html}
+		}
+
+		if err = conn.WriteJSON(map[string]interface{}{"id": req.ID, "result": result}); err != nil {
+			return
+		}
+		for _, ev := range events {
+			if err = conn.WriteJSON(ev); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestScrapeWaitFor(t *testing.T) {
+	shortDelays(t)
+	events := map[string]string{
+		"":            "Page.domContentEventFired",
+		"domcontent":  "Page.domContentEventFired",
+		"load":        "Page.loadEventFired",
+		"networkidle": "Page.lifecycleEvent",
+	}
+	for waitFor, want := range events {
+		for _, fired := range []string{"Page.domContentEventFired", "Page.loadEventFired", "Page.lifecycleEvent"} {
+			f := newFakeDevTools(t)
+			f.addCommits(fiveCommits()[3:]...)
+			f.fires = []string{fired}
+			opts := f.options()
+			opts.WaitFor, opts.PageTimeout = waitFor, 200*time.Millisecond
+
+			_, err := Scrape(context.Background(), opts)
+			if fired == want && err != nil {
+				t.Errorf("waiting for %q with %s fired: %v", waitFor, fired, err)
+			} else if fired != want && !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("waiting for %q with only %s fired = %v, want the page timing out", waitFor, fired, err)
+			}
+			if lifecycle := len(f.called("Page.setLifecycleEventsEnabled")) > 0; lifecycle != (waitFor == "networkidle") {
+				t.Errorf("waiting for %q turned lifecycle events on: %v", waitFor, lifecycle)
+			}
+		}
+	}
+	for _, event := range []string{"networkidle", "", "dom"} {
+		if ok := event != "dom"; HasWaitFor(event) != ok {
+			t.Errorf("HasWaitFor(%q) = %v", event, !ok)
+		}
+	}
+}
+
+func TestScrapePageTimeout(t *testing.T) {
+	shortDelays(t)
+	cmts := fiveCommits()
+	slow := testRepo + "/+/" + cmts[2].hash
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	t.Run("retried", func(t *testing.T) {
+		f := newFakeDevTools(t)
+		f.addCommits(cmts...)
+		f.hang[slow] = 1
+		opts := f.options()
+		opts.PageTimeout, opts.Retries = 200*time.Millisecond, 1
+
+		conts, err := Scrape(ctx, opts)
+		if err != nil {
+			t.Fatalf("Scrape: %v", err)
+		}
+		if got, want := authors(conts), "a@chromium.org b@chromium.org c@chromium.org d@chromium.org e@chromium.org"; got != want {
+			t.Errorf("counted %q, want %q", got, want)
+		}
+		if n := f.navigations(slow); n != 2 {
+			t.Errorf("navigated to the slow page %d times, want 2", n)
+		}
+	})
+
+	t.Run("not retried", func(t *testing.T) {
+		f := newFakeDevTools(t)
+		f.addCommits(cmts...)
+		f.hang[slow] = 1
+		opts := f.options()
+		opts.PageTimeout = 200 * time.Millisecond
+
+		start := time.Now()
+		_, err := Scrape(ctx, opts)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, want the page timing out", err)
+		}
+		if took := time.Since(start); took > 10*time.Second {
+			t.Errorf("took %v to give up on the page", took)
+		}
+		if ctx.Err() != nil {
+			t.Error("the page timing out ended the whole run")
+		}
+	})
+}
+
+func TestScrapeWaitsForSelector(t *testing.T) {
+	f := newFakeDevTools(t)
+	f.addCommits(fiveCommits()...)
+	f.selectorAfter = 1
+	opts := f.options()
+	opts.WaitSelector, opts.WaitTimeout = "pre.MetadataMessage", 10*time.Second
+
+	conts, err := Scrape(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Scrape: %v", err)
+	}
+	if got, want := authors(conts), "a@chromium.org b@chromium.org c@chromium.org d@chromium.org e@chromium.org"; got != want {
+		t.Errorf("counted %q, want %q", got, want)
+	}
+	if n, pages := len(f.called("DOM.querySelector")), len(f.called("Page.navigate")); n != 2*pages {
+		t.Errorf("queried the selector %d times over %d pages, want 2 each", n, pages)
+	}
+	for _, p := range f.called("DOM.querySelector") {
+		var args struct {
+			Selector string `json:"selector"`
+		}
+		json.Unmarshal(p, &args)
+		if args.Selector != opts.WaitSelector {
+			t.Fatalf("queried %q, want %q", args.Selector, opts.WaitSelector)
+		}
+	}
+
+	// without waiting, the pages are read before their content arrives
+	opts.WaitSelector = ""
+	if _, err = Scrape(context.Background(), opts); err == nil {
+		t.Error("Scrape of pages without their content succeeded")
+	}
+}
+
+func TestScrapeSelectorTimeout(t *testing.T) {
+	f := newFakeDevTools(t)
+	f.addCommits(fiveCommits()...)
+	// never shows up
+	f.selectorAfter = 1 << 30
+	opts := f.options()
+	opts.WaitSelector, opts.WaitTimeout = "pre.MetadataMessage", 150*time.Millisecond
+
+	start := time.Now()
+	_, err := Scrape(context.Background(), opts)
+	if err == nil {
+		t.Error("Scrape of pages without their content succeeded")
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("took %v to give up waiting", took)
+	}
+}
+
+// manyCommits is a linear history of n commits by a few authors, reviewed by
+// the others.
+func manyCommits(n int) []testCommit {
+	people := []string{"A <a@chromium.org>", "B <b@chromium.org>", "C <c@chromium.org>", "D <d@google.com>"}
+	cmts := make([]testCommit, n)
+	for i := range cmts {
+		cmts[i] = testCommit{hash: fmt.Sprintf("%04x%036d", n-i, 0), author: people[i%3],
+			msg: fmt.Sprintf("Change %d\n\nReviewed-by: %s\n", n-i, people[(i+1)%4])}
+	}
+	return linear(cmts...)
+}
+
+func TestScrapeConcurrentMatchesSerial(t *testing.T) {
+	cmts := manyCommits(23)
+	scrapeWith := func(concurrency int) (map[string]Contribution, []string, *fakeDevTools) {
+		f := newFakeDevTools(t)
+		f.addCommits(cmts...)
+		f.addLog(cmts, 10)
+		opts := f.options()
+		opts.Concurrency = concurrency
+		var order []string
+		opts.Commit = func(cmt CommitRecord) { order = append(order, cmt.Hash) }
+		conts, err := Scrape(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("Scrape with concurrency %d: %v", concurrency, err)
+		}
+		return conts, order, f
+	}
+
+	serial, serialOrder, _ := scrapeWith(1)
+	if len(serialOrder) != len(cmts) {
+		t.Fatalf("counted %d commits serially, want %d", len(serialOrder), len(cmts))
+	}
+	conts, order, f := scrapeWith(4)
+	if !reflect.DeepEqual(conts, serial) {
+		t.Errorf("concurrent counts %v, want the serial ones %v", conts, serial)
+	}
+	if !reflect.DeepEqual(order, serialOrder) {
+		t.Errorf("concurrent order %q, want %q", order, serialOrder)
+	}
+	if f.tabs != 4 {
+		t.Errorf("opened %d tabs, want 4", f.tabs)
+	}
+	if n := f.navigations(testRepo + "/+log/" + cmts[0].hash + "?pretty=full&s=" + cmts[20].hash); n != 1 {
+		t.Errorf("read the last log page %d times, want once", n)
+	}
+}
+
+func TestScrapeDiffstatThroughLog(t *testing.T) {
+	cmts := linear(
+		testCommit{hash: "c3f0", author: "A <a@chromium.org>", msg: "Third\n",
+			diffstat: "2 files changed, 1,204 insertions(+), 7 deletions(-)"},
+		testCommit{hash: "c2f0", author: "B <b@chromium.org>", msg: "Merge\n"},
+		testCommit{hash: "c1f0", author: "A <a@chromium.org>", msg: "First\n",
+			diffstat: "1 file changed, 1 insertion(+), 3 deletions(-)"},
+	)
+	f := newFakeDevTools(t)
+	f.addCommits(cmts...)
+	f.addLog(cmts, 10)
+
+	// the listing alone, without the diffstat
+	conts, err := Scrape(context.Background(), f.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := conts["a@chromium.org"]; a.Created != 2 || a.Insertions != 0 || a.Deletions != 0 {
+		t.Errorf("a = %+v, want the lines of the listing, none", a)
+	}
+	for _, c := range cmts {
+		if n := f.navigations(testRepo + "/+/" + c.hash); n != 0 {
+			t.Errorf("loaded the page of %s %d times without commit pages asked for", c.hash, n)
+		}
+	}
+
+	opts := f.options()
+	opts.CommitPages = true
+	if conts, err = Scrape(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if a := conts["a@chromium.org"]; a.Insertions != 1205 || a.Deletions != 10 {
+		t.Errorf("lines of a = +%d -%d, want +1205 -10", a.Insertions, a.Deletions)
+	}
+	if b := conts["b@chromium.org"]; b.Created != 1 || b.Insertions != 0 || b.Deletions != 0 {
+		t.Errorf("b = %+v, want an empty merge counting no lines", b)
+	}
+	if n := f.navigations(testRepo + "/+/c3f0"); n != 1 {
+		t.Errorf("loaded the page of c3f0 %d times, want the diffstat read from it once", n)
+	}
+}
+
+// sitePages serves pages, and notFoundPage for urls missing from it, the way
+// a browser shows a 404. The urls fetched are appended to fetched.
+func sitePages(pages map[string]string, fetched *[]string) fetchFunc {
+	return parsed(func(url string) (string, error) {
+		*fetched = append(*fetched, url)
+		if p, ok := pages[url]; ok {
+			return p, nil
+		}
+		return notFoundPage, nil
+	})
+}
+
+func TestTipCommitPrefersRefLink(t *testing.T) {
+	tag := testCommit{hash: "7a9f", author: "Jane Doe <jdoe@chromium.org>", msg: "Tagged\n"}
+	tip := testCommit{hash: "c3f0", author: "Jane Doe <jdoe@chromium.org>", msg: "Tip\n"}
+	// a tag named after the branch is listed before it
+	repoPage := `<html><body><ul>` +
+		`<li><a href="/chromiumos/platform/tast-tests/+/refs/tags/main-2021">main-2021</a></li>` +
+		`<li><a href="/chromiumos/platform/tast-tests/+/refs/heads/main">main</a></li>` +
+		`</ul></body></html>`
+	opts := Options{RepoURL: testRepo, Branch: "main"}
+
+	scanned, err := getMainLink(parseString(t, repoPage), testRepo, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	constructed, err := gitiles{}.RefLink(testRepo, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scanned != testRepo+"/+/refs/tags/main-2021" || constructed != testRepo+"/+/refs/heads/main" {
+		t.Fatalf("scanned %s, constructed %s", scanned, constructed)
+	}
+
+	pages := map[string]string{
+		testRepo:    repoPage,
+		scanned:     commitPage(tag),
+		constructed: commitPage(tip),
+	}
+	var fetched []string
+	if hash, err := tipCommit(opts, Gitiles, sitePages(pages, &fetched)); err != nil || hash != "c3f0" {
+		t.Errorf("tipCommit = %q, %v, want the c3f0 of refs/heads/main", hash, err)
+	}
+	if len(fetched) != 1 {
+		t.Errorf("fetched %q, want only the refs/heads link", fetched)
+	}
+
+	// only scanned for when the link of the branch isn't a commit page
+	old := testCommit{hash: "b2f0", author: "Jane Doe <jdoe@chromium.org>", msg: "Old tip\n"}
+	pages = map[string]string{
+		testRepo:             `<html><body><a href="/chromiumos/platform/tast-tests/+/main">main</a></body></html>`,
+		testRepo + "/+/main": commitPage(old),
+	}
+	fetched = nil
+	if hash, err := tipCommit(opts, Gitiles, sitePages(pages, &fetched)); err != nil || hash != "b2f0" {
+		t.Errorf("tipCommit with refs/heads/main missing = %q, %v, want the b2f0 of the scanned link", hash, err)
+	}
+	if want := []string{constructed, testRepo, testRepo + "/+/main"}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("fetched %q, want %q", fetched, want)
+	}
+}
+
+func TestTipCommit(t *testing.T) {
+	const hash = "c3f0a1b2c3d4e5f60718293a4b5c6d7e8f901234"
+	tip := testCommit{hash: hash, author: "Jane Doe <jdoe@chromium.org>", msg: "Tip\n", parents: []string{"b2f0"}}
+	tagged := testCommit{hash: "7a9f", author: "Jane Doe <jdoe@chromium.org>", msg: "Tagged\n"}
+	pages := map[string]string{
+		testRepo + "/+/refs/heads/main": commitPage(tip),
+		testRepo + "/+/refs/tags/v1.2":  commitPage(tagged),
+		testRepo + "/+/" + hash:         commitPage(tip),
+		testRepo + "/+/b2f0":            commitPage(testCommit{hash: "b2f0", author: "A <a@chromium.org>", msg: "Root\n"}),
+	}
+	for _, tc := range []struct {
+		branch, want string
+		fetches      int
+	}{
+		{"main", hash, 1},
+		{"refs/tags/v1.2", "7a9f", 1},
+		// a full hash is taken as is
+		{hash, hash, 0},
+		{"0123456789abcdef0123456789abcdef01234567", "0123456789abcdef0123456789abcdef01234567", 0},
+	} {
+		var fetched []string
+		got, err := tipCommit(Options{RepoURL: testRepo, Branch: tc.branch}, Gitiles, sitePages(pages, &fetched))
+		if err != nil || got != tc.want || len(fetched) != tc.fetches {
+			t.Errorf("tipCommit of %s = %q, %v after fetching %q, want %q after %d fetches", tc.branch, got, err,
+				fetched, tc.want, tc.fetches)
+		}
+	}
+
+	var fetched []string
+	if _, err := tipCommit(Options{RepoURL: testRepo, Branch: "gone"}, Gitiles, sitePages(pages, &fetched)); err == nil {
+		t.Error("tipCommit of a missing branch succeeded")
+	}
+
+	// the walk starts at the page of the tip commit, not at that of the branch
+	fetched = nil
+	w, _, err := newWalker(Options{RepoURL: testRepo, Branch: "main"}, sitePages(pages, &fetched), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var walked []string
+	for {
+		_, url, err := w.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		walked = append(walked, url)
+	}
+	if want := []string{testRepo + "/+/" + hash, testRepo + "/+/b2f0"}; !reflect.DeepEqual(walked, want) {
+		t.Errorf("walked %q, want %q", walked, want)
+	}
+	if fetched[0] != testRepo+"/+/refs/heads/main" {
+		t.Errorf("first fetched %s, want the branch", fetched[0])
+	}
+	for _, u := range fetched[1:] {
+		if strings.Contains(u, "refs/heads") {
+			t.Errorf("fetched the branch again at %s", u)
+		}
+	}
+}
+
+// callsBefore returns the methods called before the first navigation.
+func (f *fakeDevTools) callsBefore(method string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var methods []string
+	for _, c := range f.calls {
+		if c.method == method {
+			break
+		}
+		methods = append(methods, c.method)
+	}
+	return methods
+}
+
+func TestScrapeUserAgent(t *testing.T) {
+	for _, ua := range []string{"", "gsoc-chromium-starter/1.0 (+https://github.com/mido3ds/gsoc-chromium-starter)"} {
+		f := newFakeDevTools(t)
+		f.addCommits(fiveCommits()...)
+		opts := f.options()
+		opts.UserAgent = ua
+		scrape(t, opts)
+
+		calls := f.called("Emulation.setUserAgentOverride")
+		if ua == "" {
+			if len(calls) > 0 {
+				t.Errorf("overrode the user agent with %s without one asked for", calls[0])
+			}
+			continue
+		}
+		if len(calls) != 1 {
+			t.Fatalf("overrode the user agent %d times, want once", len(calls))
+		}
+		var p struct {
+			UserAgent string `json:"userAgent"`
+		}
+		if err := json.Unmarshal(calls[0], &p); err != nil || p.UserAgent != ua {
+			t.Errorf("user agent set to %s, want %q", calls[0], ua)
+		}
+		if !containsString(f.callsBefore("Page.navigate"), "Emulation.setUserAgentOverride") {
+			t.Error("navigated before overriding the user agent")
+		}
+	}
+}
+
+func TestScrapeSendsCookiesAndHeaders(t *testing.T) {
+	f := newFakeDevTools(t)
+	f.addCommits(fiveCommits()...)
+	opts := f.options()
+	opts.Cookies = map[string]string{"SID": "s3cr3t"}
+	opts.Headers = map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}
+	scrape(t, opts)
+
+	before := f.callsBefore("Page.navigate")
+	for _, m := range []string{"Network.enable", "Network.setCookies", "Network.setExtraHTTPHeaders"} {
+		if !containsString(before, m) {
+			t.Errorf("%s not called before navigating, only %q", m, before)
+		}
+	}
+	var cookies struct {
+		Cookies []struct {
+			Name, Value, URL, Path string
+		}
+	}
+	if calls := f.called("Network.setCookies"); len(calls) != 1 || json.Unmarshal(calls[0], &cookies) != nil ||
+		len(cookies.Cookies) != 1 {
+		t.Fatalf("set cookies with %s", calls)
+	}
+	if c := cookies.Cookies[0]; c.Name != "SID" || c.Value != "s3cr3t" || c.URL != testRepo || c.Path != "/" {
+		t.Errorf("set cookie %+v, want SID=s3cr3t on the whole host of the repo", c)
+	}
+	var headers struct {
+		Headers map[string]string
+	}
+	if calls := f.called("Network.setExtraHTTPHeaders"); len(calls) != 1 || json.Unmarshal(calls[0], &headers) != nil {
+		t.Fatalf("set headers with %s", calls)
+	}
+	if !reflect.DeepEqual(headers.Headers, opts.Headers) {
+		t.Errorf("set headers %v, want %v", headers.Headers, opts.Headers)
+	}
+
+	// nothing is set up without any
+	f = newFakeDevTools(t)
+	f.addCommits(fiveCommits()...)
+	scrape(t, f.options())
+	if n := len(f.called("Network.setCookies")) + len(f.called("Network.setExtraHTTPHeaders")); n > 0 {
+		t.Errorf("made %d auth calls without cookies or headers", n)
+	}
+}
+
+func TestScrapeReconnects(t *testing.T) {
+	shortDelays(t)
+	cmts := fiveCommits()
+	dropped := testRepo + "/+/" + cmts[2].hash
+	f := newFakeDevTools(t)
+	f.addCommits(cmts...)
+	f.drop[dropped] = 1
+	opts := f.options()
+	opts.Retries = 3
+
+	conts, err := Scrape(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Scrape with the connection dropped once: %v", err)
+	}
+	if got, want := authors(conts), "a@chromium.org b@chromium.org c@chromium.org d@chromium.org e@chromium.org"; got != want {
+		t.Errorf("counted %q, want %q", got, want)
+	}
+	f.mu.Lock()
+	dials := f.dials
+	f.mu.Unlock()
+	if dials != 2 {
+		t.Errorf("dialed %d times, want once more after the drop", dials)
+	}
+	if n := f.navigations(dropped); n != 2 {
+		t.Errorf("navigated to the dropped page %d times, want it retried once", n)
+	}
+	// the new connection is set up like the first one
+	if n := len(f.called("Page.enable")); n != 2 {
+		t.Errorf("enabled Page %d times, want on both connections", n)
+	}
+
+	// reconnecting is bounded, even with retries left
+	f = newFakeDevTools(t)
+	f.addCommits(cmts...)
+	f.drop[dropped] = 100
+	opts = f.options()
+	opts.Retries = 10
+	if _, err = Scrape(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "giving up") {
+		t.Fatalf("Scrape with the connection always dropping = %v, want it to give up", err)
+	}
+	f.mu.Lock()
+	dials = f.dials
+	f.mu.Unlock()
+	if dials != maxReconnects+1 {
+		t.Errorf("dialed %d times, want %d", dials, maxReconnects+1)
+	}
+	if n := f.navigations(dropped); n != maxReconnects+1 {
+		t.Errorf("navigated to the dropped page %d times, want no retries once given up", n)
+	}
+
+	// drops apart from each other don't add up to giving up
+	f = newFakeDevTools(t)
+	f.addCommits(cmts...)
+	for _, c := range cmts {
+		f.drop[testRepo+"/+/"+c.hash] = 1
+	}
+	opts = f.options()
+	opts.Retries = 3
+	if _, err = Scrape(context.Background(), opts); err != nil {
+		t.Fatalf("Scrape with the connection dropped on every commit: %v", err)
+	}
+	f.mu.Lock()
+	dials = f.dials
+	f.mu.Unlock()
+	if want := len(cmts) + 1; dials != want {
+		t.Errorf("dialed %d times, want %d", dials, want)
+	}
+}
+
+// shortThrottle has the backoff after being throttled start at base, up to
+// max, for the test.
+func shortThrottle(t *testing.T, base, max time.Duration) {
+	prevBase, prevMax := throttleBaseDelay, throttleMaxDelay
+	throttleBaseDelay, throttleMaxDelay = base, max
+	t.Cleanup(func() { throttleBaseDelay, throttleMaxDelay = prevBase, prevMax })
+}
+
+func readThrottlePage(t *testing.T) string {
+	b, err := ioutil.ReadFile(filepath.Join("..", "testdata", "throttle", "429.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestIsThrottlePage(t *testing.T) {
+	if !isThrottlePage(readThrottlePage(t)) {
+		t.Error("the 429 page isn't taken for a throttle page")
+	}
+	for _, p := range []string{
+		commitPage(testCommit{hash: "c1f0", author: "A <a@chromium.org>", msg: "Retry on 429 Too Many Requests\n"}),
+		readTestPage(t, "main.html"),
+		notFoundPage,
+	} {
+		if isThrottlePage(p) {
+			t.Errorf("taken for a throttle page: %.80s", p)
+		}
+	}
+}
+
+func TestScrapeBacksOffWhenThrottled(t *testing.T) {
+	shortDelays(t)
+	shortThrottle(t, 10*time.Millisecond, 20*time.Millisecond)
+	logs := captureLogs(t)
+	cmts := fiveCommits()
+	throttled := testRepo + "/+/" + cmts[2].hash
+	throttle := readThrottlePage(t)
+	f := newFakeDevTools(t)
+	f.addCommits(cmts...)
+	f.before[throttled] = []string{throttle, throttle, throttle}
+	opts := f.options()
+	opts.Retries = 3
+
+	start := time.Now()
+	conts, err := Scrape(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Scrape throttled 3 times: %v", err)
+	}
+	if took := time.Since(start); took < 50*time.Millisecond {
+		t.Errorf("took %v, want backing off at least 10+20+20ms", took)
+	}
+	if len(conts) != len(cmts) {
+		t.Errorf("got %d contributors, want %d", len(conts), len(cmts))
+	}
+	if n := f.navigations(throttled); n != 4 {
+		t.Errorf("navigated to the throttled page %d times, want 4", n)
+	}
+	// the delay doubles, up to the cap
+	var delays []string
+	for _, l := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(l, "throttled by the server, backing off") {
+			delays = append(delays, l[strings.Index(l, "delay="):])
+		}
+	}
+	if want := []string{"delay=10ms", "delay=20ms", "delay=20ms"}; !reflect.DeepEqual(delays, want) {
+		t.Errorf("backed off with %q, want %q", delays, want)
+	}
+
+	// given up on like other failures once out of retries
+	f = newFakeDevTools(t)
+	f.addCommits(cmts...)
+	f.before[throttled] = []string{throttle, throttle, throttle}
+	opts = f.options()
+	opts.Retries = 1
+	var terr *throttledError
+	if _, err = Scrape(context.Background(), opts); !errors.As(err, &terr) {
+		t.Errorf("Scrape out of retries = %v, want a throttled error", err)
+	}
+}
@@ -0,0 +1,39 @@
+package contrib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+type pageFunc func(url string) (string, error)
+
+// withCache stores every page fetched by fetch in dir, keyed by a hash of its
+// url, and serves later requests for the same url from there. With refresh
+// set, cached pages are ignored and overwritten.
+func withCache(fetch pageFunc, dir string, refresh bool) pageFunc {
+	return func(url string) (string, error) {
+		sum := sha256.Sum256([]byte(url))
+		path := filepath.Join(dir, hex.EncodeToString(sum[:])+".html")
+
+		if !refresh {
+			if b, err := ioutil.ReadFile(path); err == nil {
+				return string(b), nil
+			}
+		}
+
+		r, err := fetch(url)
+		if err != nil {
+			return "", err
+		}
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		if err = writeFile(path, []byte(r), 0644); err != nil {
+			return "", err
+		}
+		return r, nil
+	}
+}
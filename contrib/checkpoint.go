@@ -0,0 +1,66 @@
+package contrib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// checkpoint is the state of a walk saved to resume it from in a later run.
+type checkpoint struct {
+	RepoURL string `json:"repo_url"`
+	Branch  string `json:"branch"`
+	// Last is the hash of the last commit the walk was done with, which it
+	// resumes after.
+	Last    string   `json:"last"`
+	Counted int      `json:"counted"`
+	Visited []string `json:"visited"`
+	// Contributions are those counted until Last, included.
+	Contributions map[string]Contribution `json:"contributions"`
+}
+
+// loadCheckpoint reads the checkpoint at path, nil if there's none. It must
+// be of the history opts selects.
+func loadCheckpoint(path string, opts Options) (*checkpoint, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp checkpoint
+	if err = json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("can't read checkpoint %s: %v", path, err)
+	}
+	if cp.RepoURL != opts.RepoURL || cp.Branch != opts.Branch {
+		return nil, fmt.Errorf("checkpoint %s is of %s %s, not of %s %s", path, cp.RepoURL, cp.Branch, opts.RepoURL,
+			opts.Branch)
+	}
+	if cp.Last == "" {
+		return nil, fmt.Errorf("checkpoint %s has no commit to resume after", path)
+	}
+	return &cp, nil
+}
+
+// CheckpointCounted returns how many commits the checkpoint Scrape resumes
+// from with opts had counted, and whether there's one to resume from.
+func CheckpointCounted(opts Options) (int, bool, error) {
+	if opts.Checkpoint == "" || opts.Restart {
+		return 0, false, nil
+	}
+	cp, err := loadCheckpoint(opts.Checkpoint, opts)
+	if err != nil || cp == nil {
+		return 0, false, err
+	}
+	return cp.Counted, true, nil
+}
+
+func (cp *checkpoint) save(path string) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, b, 0644)
+}
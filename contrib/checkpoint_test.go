@@ -0,0 +1,107 @@
+package contrib
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// scrapeCut runs Scrape over opts expecting it to fail, and returns the
+// checkpoint it saved.
+func scrapeCut(t *testing.T, opts Options) *checkpoint {
+	t.Helper()
+	if _, err := Scrape(context.Background(), opts); err == nil {
+		t.Fatal("Scrape succeeded, want it to fail midway")
+	}
+	cp, err := loadCheckpoint(opts.Checkpoint, opts)
+	if err != nil || cp == nil {
+		t.Fatalf("no checkpoint saved: %v", err)
+	}
+	return cp
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestScrapeResumesFromCheckpoint(t *testing.T) {
+	want := scrape(t, offlineRepo(t, fiveCommits()...))
+
+	opts := offlineRepo(t, fiveCommits()...)
+	opts.Checkpoint = filepath.Join(t.TempDir(), "checkpoint.json")
+	page := filepath.Join(opts.HTMLDir, "c3f0.html")
+	saved := readFile(t, page)
+	if err := os.Remove(page); err != nil {
+		t.Fatal(err)
+	}
+	cp := scrapeCut(t, opts)
+	if cp.Last != "d4f0" || cp.Counted != 2 {
+		t.Errorf("checkpoint after %s with %d counted, want after d4f0 with 2", cp.Last, cp.Counted)
+	}
+
+	writeTestFile(t, page, saved)
+	if got := scrape(t, opts); !reflect.DeepEqual(got, want) {
+		t.Errorf("resumed to %v, want %v as in a run never cut", got, want)
+	}
+	if _, err := os.Stat(opts.Checkpoint); !os.IsNotExist(err) {
+		t.Errorf("checkpoint left after the walk finished: %v", err)
+	}
+}
+
+func TestCheckpointLeavesCommitFailingToWrite(t *testing.T) {
+	want := scrape(t, offlineRepo(t, fiveCommits()...))
+
+	opts := offlineRepo(t, fiveCommits()...)
+	opts.Checkpoint = filepath.Join(t.TempDir(), "checkpoint.json")
+	opts.CommitsPath = t.TempDir()
+	// a directory in the way of the commit file of c3f0
+	blocker := filepath.Join(opts.CommitsPath, "c3f0.commit")
+	if err := os.Mkdir(blocker, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cp := scrapeCut(t, opts)
+	if cp.Last != "d4f0" || cp.Counted != 2 || cp.Contributions["c@chromium.org"].Created != 0 {
+		t.Errorf("checkpoint after %s with %d counted and %v, want c3f0 left out", cp.Last, cp.Counted, cp.Contributions)
+	}
+
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+	if got := scrape(t, opts); !reflect.DeepEqual(got, want) {
+		t.Errorf("resumed to %v, want %v", got, want)
+	}
+}
+
+func TestCheckpointAfterSkippedCommits(t *testing.T) {
+	cmts := fiveCommits()
+	for i := range cmts {
+		cmts[i].files = []string{"README.md"}
+	}
+	// only b2f0 is of the path, the ones after it are skipped
+	cmts[3].files = []string{"src/widget.cc"}
+	opts := offlineRepo(t, cmts...)
+	opts.IncludePath = "src"
+	opts.Checkpoint = filepath.Join(t.TempDir(), "checkpoint.json")
+	page := filepath.Join(opts.HTMLDir, "b2f0.html")
+	saved := readFile(t, page)
+	if err := os.Remove(page); err != nil {
+		t.Fatal(err)
+	}
+	cp := scrapeCut(t, opts)
+	if cp.Last != "c3f0" || cp.Counted != 0 {
+		t.Errorf("checkpoint after %s with %d counted, want after the skipped c3f0 with none", cp.Last, cp.Counted)
+	}
+
+	writeTestFile(t, page, saved)
+	if got := authors(scrape(t, opts)); got != "b@chromium.org" {
+		t.Errorf("resumed to authors %s, want b@chromium.org", got)
+	}
+}
@@ -0,0 +1,176 @@
+package contrib
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// CommitRecord holds everything extracted from a single commit page.
+type CommitRecord struct {
+	// Repo is the url of the repo the commit was scraped from, only set by
+	// ScrapeRepos.
+	Repo        string    `json:"repo,omitempty"`
+	Hash        string    `json:"hash"`
+	Author      string    `json:"author"`
+	Committer   string    `json:"committer"`
+	Date        time.Time `json:"date"`
+	Parents     []string  `json:"parents"`
+	Reviewers   []string  `json:"reviewers"`
+	SignedOffBy []string  `json:"signed_off_by"`
+	TestedBy    []string  `json:"tested_by"`
+	CoAuthors   []string  `json:"co_authors"`
+	Bugs        []string  `json:"bugs"`
+	ChangeID    string    `json:"change_id"`
+	// Revert and Reland tell whether the commit undoes or redoes another.
+	Revert bool `json:"revert"`
+	Reland bool `json:"reland"`
+	// Subject is the first paragraph of Message, its lines joined by
+	// spaces.
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+	// Insertions and Deletions are the totals of the diffstat, zero for
+	// commits without one, like empty merges.
+	Insertions int `json:"insertions"`
+	Deletions  int `json:"deletions"`
+	// Buckets are who the trailers of Options.TrailerBuckets name, by
+	// bucket.
+	Buckets map[string][]string `json:"buckets,omitempty"`
+	// Files are the paths the commit changed, nil when the page it was
+	// read from doesn't list them.
+	Files []string `json:"files"`
+}
+
+// parsePage parses the commit page doc fetched from url. Failures are
+// reported as a *parseError telling url and the start of the page.
+func parsePage(src Source, doc *html.Node, url string) (CommitRecord, error) {
+	cmt, err := parseCommit(src, doc)
+	if err != nil {
+		return cmt, &parseError{hash: cmt.Hash, err: fmt.Errorf("%w at %s, near %q", err, url, snippet(doc))}
+	}
+	return cmt, nil
+}
+
+func parseCommit(src Source, doc *html.Node) (CommitRecord, error) {
+	var rec CommitRecord
+	var err error
+
+	if rec.Hash, err = src.CommitHash(doc); err != nil {
+		return rec, err
+	}
+	if rec.Message, err = src.Message(doc); err != nil {
+		return rec, err
+	}
+	if rec.Author, err = src.Author(doc); err != nil {
+		return rec, err
+	}
+	if rec.Date, err = src.AuthorDate(doc); err != nil {
+		return rec, err
+	}
+	if rec.Committer, err = src.Committer(doc); err != nil {
+		return rec, err
+	}
+	if rec.Parents, err = src.Parents(doc); err != nil {
+		return rec, err
+	}
+	if rec.Reviewers, err = src.Reviewers(rec.Message); err != nil {
+		return rec, err
+	}
+	if ds, ok := src.(diffstatSource); ok {
+		rec.Insertions, rec.Deletions = ds.Diffstat(doc)
+	}
+	if fs, ok := src.(filesSource); ok {
+		rec.Files = fs.Files(doc)
+	}
+	if err = readMessage(&rec); err != nil {
+		return rec, err
+	}
+
+	// names may come out of the page still entity encoded, like O&#39;Brien
+	rec.Author = html.UnescapeString(rec.Author)
+	rec.Committer = html.UnescapeString(rec.Committer)
+	for _, people := range [][]string{rec.Reviewers, rec.SignedOffBy, rec.TestedBy, rec.CoAuthors} {
+		for i := range people {
+			people[i] = html.UnescapeString(people[i])
+		}
+	}
+	return rec, nil
+}
+
+// readMessage fills in what rec's message tells, besides the reviewers whose
+// trailers differ between sources.
+func readMessage(rec *CommitRecord) error {
+	var err error
+	if rec.SignedOffBy, err = getSignedOffBy(rec.Message); err != nil {
+		return err
+	}
+	if rec.TestedBy, err = getTestedBy(rec.Message); err != nil {
+		return err
+	}
+	if rec.CoAuthors, err = getCoAuthors(rec.Message); err != nil {
+		return err
+	}
+	rec.Subject = getSubject(rec.Message)
+	rec.Bugs = getBugs(rec.Message)
+	rec.ChangeID = getChangeID(rec.Message)
+	rec.Revert, rec.Reland = isRevert(rec.Message), isReland(rec.Message)
+	return nil
+}
+
+// HasCommitFormat reports whether commit files can be written in format.
+func HasCommitFormat(format string) bool {
+	return format == "" || format == "text" || format == "json"
+}
+
+// truncatedMarker ends commit messages cut short in commit files.
+const truncatedMarker = "...[truncated]"
+
+// writeCommitFile writes the commit to opts.CommitsPath, as <hash>.commit
+// holding its message for the "text" format or <hash>.json holding the whole
+// record for the "json" one, gzipped with a .gz suffix if opts.GzipCommits is
+// set. The message written loses its trailers if opts.StripTrailers is set,
+// and is cut at opts.MaxCommitBytes if above 0.
+func writeCommitFile(opts Options, cmt CommitRecord) error {
+	if opts.StripTrailers {
+		keys := append(messageTrailers[:len(messageTrailers):len(messageTrailers)], opts.ReviewerKeys...)
+		for k := range opts.TrailerBuckets {
+			keys = append(keys, k)
+		}
+		cmt.Message = stripTrailers(cmt.Message, keys)
+	}
+	cmt.Message = truncateMessage(cmt.Message, opts.MaxCommitBytes)
+	suffix := ""
+	if opts.GzipCommits {
+		suffix = ".gz"
+	}
+	dir := opts.CommitsPath
+	switch opts.CommitFormat {
+	case "", "text":
+		return writeOutputFile(filepath.Join(dir, cmt.Hash+".commit"+suffix), []byte(cmt.Message))
+	case "json":
+		b, err := json.MarshalIndent(cmt, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeOutputFile(filepath.Join(dir, cmt.Hash+".json"+suffix), b)
+	default:
+		return fmt.Errorf("unknown commit format %q", opts.CommitFormat)
+	}
+}
+
+// truncateMessage cuts msg to maxBytes, without splitting a character, and
+// marks it as truncated. It's left alone if it fits or maxBytes is 0.
+func truncateMessage(msg string, maxBytes int) string {
+	if maxBytes <= 0 || len(msg) <= maxBytes {
+		return msg
+	}
+	n := maxBytes
+	for n > 0 && !utf8.RuneStart(msg[n]) {
+		n--
+	}
+	return msg[:n] + truncatedMarker
+}
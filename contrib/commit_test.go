@@ -0,0 +1,266 @@
+package contrib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// readTestPage reads the saved page name of testdata/gitiles.
+func readTestPage(t testing.TB, name string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("..", "testdata", "gitiles", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// countingPages serves page for every url, counting the calls in n.
+func countingPages(page string, n *int) pageFunc {
+	return func(url string) (string, error) {
+		*n++
+		return page, nil
+	}
+}
+
+// BenchmarkParseCommit compares reading a commit from its page parsed once
+// with parsing it again for each extractor, the way commits were read before
+// extractors took a parsed page.
+func BenchmarkParseCommit(b *testing.B) {
+	page := readTestPage(b, "main.html")
+	url := testRepo + "/+/5d1e7c0a9f3b42e6a8c1d0f7b2e9a4c6d3f8b1e0"
+
+	b.Run("once", func(b *testing.B) {
+		parses := 0
+		fetch := parsed(countingPages(page, &parses))
+		for i := 0; i < b.N; i++ {
+			doc, err := fetch(url)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err = parseCommit(Gitiles, doc); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(parses)/float64(b.N), "parses/op")
+	})
+
+	b.Run("per-extractor", func(b *testing.B) {
+		parses := 0
+		fetch := parsed(countingPages(page, &parses))
+		extractors := []func(doc *html.Node) error{
+			func(doc *html.Node) error { _, err := Gitiles.CommitHash(doc); return err },
+			func(doc *html.Node) error { _, err := Gitiles.Message(doc); return err },
+			func(doc *html.Node) error { _, err := Gitiles.Author(doc); return err },
+			func(doc *html.Node) error { _, err := Gitiles.AuthorDate(doc); return err },
+			func(doc *html.Node) error { _, err := Gitiles.Committer(doc); return err },
+			func(doc *html.Node) error { _, err := Gitiles.Parents(doc); return err },
+			func(doc *html.Node) error { _, err := Gitiles.ParentLink(doc, testRepo); return err },
+		}
+		for i := 0; i < b.N; i++ {
+			for _, extract := range extractors {
+				doc, err := fetch(url)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err = extract(doc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		b.ReportMetric(float64(parses)/float64(b.N), "parses/op")
+	})
+}
+
+func TestScrapeWritesCommitFiles(t *testing.T) {
+	opts := offlineRepo(t, fiveCommits()...)
+	tmp := t.TempDir()
+	// no trailing slash, and missing
+	opts.CommitsPath = filepath.Join(tmp, "commits")
+	scrape(t, opts)
+
+	for _, c := range fiveCommits() {
+		b, err := ioutil.ReadFile(filepath.Join(tmp, "commits", c.hash+".commit"))
+		if err != nil {
+			t.Errorf("commit file of %s: %v", c.hash, err)
+			continue
+		}
+		if string(b) != c.msg {
+			t.Errorf("commit file of %s holds %q, want %q", c.hash, b, c.msg)
+		}
+	}
+	if m, _ := filepath.Glob(filepath.Join(tmp, "commits*.commit")); len(m) > 0 {
+		t.Errorf("commit files written next to the directory: %q", m)
+	}
+}
+
+func TestScrapeWithoutCommitsPath(t *testing.T) {
+	opts := offlineRepo(t, fiveCommits()...)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := t.TempDir()
+	if err = os.Chdir(tmp); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	scrape(t, opts)
+	files, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		t.Errorf("wrote %s without a commits path", f.Name())
+	}
+}
+
+func TestScrapeWritesJSONCommitFiles(t *testing.T) {
+	opts := offlineRepo(t, linear(
+		testCommit{hash: "c2f0", author: "Jane Doe <jdoe@chromium.org>", committer: "John Roe <jroe@chromium.org>",
+			msg: "Add a widget\n\nReviewed-by: John Roe <jroe@chromium.org>\n"},
+		testCommit{hash: "c1f0", author: "John Roe <jroe@chromium.org>", msg: "First\n"},
+	)...)
+	opts.CommitsPath, opts.CommitFormat = t.TempDir(), "json"
+	scrape(t, opts)
+
+	if _, err := os.Stat(filepath.Join(opts.CommitsPath, "c2f0.commit")); !os.IsNotExist(err) {
+		t.Errorf("wrote a text commit file too: %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(opts.CommitsPath, "c2f0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec map[string]interface{}
+	if err = json.Unmarshal(b, &rec); err != nil {
+		t.Fatalf("can't parse %s: %v", b, err)
+	}
+	for key, want := range map[string]interface{}{
+		"hash":      "c2f0",
+		"author":    "Jane Doe <jdoe@chromium.org>",
+		"committer": "John Roe <jroe@chromium.org>",
+		"date":      "2021-03-01T09:30:00-08:00",
+		"parents":   []interface{}{"c1f0"},
+		"reviewers": []interface{}{"John Roe <jroe@chromium.org>"},
+		"message":   "Add a widget\n\nReviewed-by: John Roe <jroe@chromium.org>\n",
+	} {
+		if got, ok := rec[key]; !ok {
+			t.Errorf("no %q in %s", key, b)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, want %#v", key, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(opts.CommitsPath, "c1f0.json")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScrapeGzipsCommitFiles(t *testing.T) {
+	opts := offlineRepo(t, fiveCommits()...)
+	opts.CommitsPath, opts.GzipCommits = t.TempDir(), true
+	scrape(t, opts)
+
+	for _, c := range fiveCommits() {
+		if got := gunzip(t, filepath.Join(opts.CommitsPath, c.hash+".commit.gz")); got != c.msg {
+			t.Errorf("commit file of %s holds %q, want %q", c.hash, got, c.msg)
+		}
+	}
+	if m, _ := filepath.Glob(filepath.Join(opts.CommitsPath, "*.commit")); len(m) > 0 {
+		t.Errorf("wrote commit files not gzipped: %q", m)
+	}
+}
+
+func TestScrapeStripsTrailers(t *testing.T) {
+	msg := "Add a widget\n\nIt shows the weather.\nTEST=tast run $DUT widget.Basic\n\n" +
+		"Bug: 123456\nChange-Id: I0f2b4d6e8a1c3e5f7b9d0a2c4e6f8b1d3a5c7e9f\n" +
+		"Reviewed-on: https://chromium-review.googlesource.com/c/chromiumos/platform/tast-tests/+/2725001\n" +
+		"Reviewed-by: John Roe <jroe@chromium.org>\nreviewed-by: Alex Poe <apoe@google.com>\n"
+	opts := offlineRepo(t, testCommit{hash: "c1f0", author: "Jane Doe <jdoe@chromium.org>", msg: msg})
+	opts.CommitsPath, opts.StripTrailers = t.TempDir(), true
+
+	conts := scrape(t, opts)
+	for _, key := range []string{"jroe@chromium.org", "apoe@google.com"} {
+		if c := conts[key]; c.Reviewed != 1 {
+			t.Errorf("%s: Reviewed = %d, want the stripped trailer still counted", key, c.Reviewed)
+		}
+	}
+	b, err := ioutil.ReadFile(filepath.Join(opts.CommitsPath, "c1f0.commit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// TEST= isn't a trailer of those counted, it's kept
+	if want := "Add a widget\n\nIt shows the weather.\nTEST=tast run $DUT widget.Basic\n"; string(b) != want {
+		t.Errorf("commit file holds %q, want %q", b, want)
+	}
+}
+
+func TestScrapeTruncatesCommitFiles(t *testing.T) {
+	var msg strings.Builder
+	msg.WriteString("Roll src/third_party 0123456..789abcd (2000 commits)\n\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&msg, "https://chromium.googlesource.com/external/dep/+/%040x Değişiklik %d\n", i, i)
+	}
+	msg.WriteString("\nReviewed-by: John Roe <jroe@chromium.org>\n")
+	opts := offlineRepo(t, testCommit{hash: "c1f0", author: "Autoroller <roller@chromium.org>", msg: msg.String()})
+	opts.CommitsPath, opts.MaxCommitBytes = t.TempDir(), 1000
+
+	conts := scrape(t, opts)
+	if c := conts["jroe@chromium.org"]; c.Reviewed != 1 {
+		t.Errorf("reviewer past the cut: Reviewed = %d, want 1", c.Reviewed)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(opts.CommitsPath, "c1f0.commit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(b)
+	if !strings.HasSuffix(s, truncatedMarker) || len(s) > opts.MaxCommitBytes+len(truncatedMarker) {
+		t.Errorf("wrote %d bytes ending in %q, want at most %d and the marker", len(s), s[len(s)-20:], opts.MaxCommitBytes)
+	}
+	if body := strings.TrimSuffix(s, truncatedMarker); !utf8.ValidString(body) || !strings.HasPrefix(msg.String(), body) {
+		t.Error("the message kept isn't a valid prefix of the message")
+	}
+
+	// not cut when it fits
+	opts.MaxCommitBytes = msg.Len()
+	scrape(t, opts)
+	if b, _ = ioutil.ReadFile(filepath.Join(opts.CommitsPath, "c1f0.commit")); string(b) != msg.String() {
+		t.Errorf("cut a message fitting in MaxCommitBytes to %d bytes", len(b))
+	}
+}
+
+func TestParseErrorTellsWhere(t *testing.T) {
+	cmts := fiveCommits()
+	// the page of c3f0 lacks an author
+	cmts[2].author = ""
+	_, err := Scrape(context.Background(), offlineRepo(t, cmts...))
+	if err == nil {
+		t.Fatal("Scrape of a broken page succeeded")
+	}
+	msg := err.Error()
+	for _, want := range []string{"can't find author", testRepo + "/+/c3f0", `near "<body class=`} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q doesn't contain %q", msg, want)
+		}
+	}
+	var perr *parseError
+	if !errors.As(err, &perr) || perr.hash != "c3f0" {
+		t.Errorf("err = %#v, want a parse error of c3f0", err)
+	}
+
+	doc := parseString(t, "<html><body>"+strings.Repeat("<p>Not a commit page.</p>", 100)+"</body></html>")
+	if s := snippet(doc); len([]rune(s)) > snippetLen+len("...") || !strings.HasPrefix(s, "<body><p>Not a commit page.</p>") {
+		t.Errorf("snippet = %q", s)
+	}
+}
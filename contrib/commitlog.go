@@ -0,0 +1,134 @@
+package contrib
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// streamFormats are written a commit at a time while scraping, by a
+// CommitLog, rather than all at once by WriteOutput.
+var streamFormats = map[string]bool{"jsonl": true}
+
+// IsStreamFormat reports whether format is written by a CommitLog.
+func IsStreamFormat(format string) bool {
+	return streamFormats[format]
+}
+
+// commitLine is a commit as the jsonl format writes it.
+type commitLine struct {
+	Repo      string    `json:"repo,omitempty"`
+	Hash      string    `json:"hash"`
+	Author    string    `json:"author"`
+	Subject   string    `json:"subject"`
+	Reviewers []string  `json:"reviewers"`
+	Date      time.Time `json:"date"`
+	Parents   []string  `json:"parents"`
+}
+
+// CommitLog writes a line for each commit as soon as it's counted, so the
+// lines written survive the run failing later on.
+type CommitLog struct {
+	f *os.File
+	// zw, if set, gzips what's written to f.
+	zw *gzip.Writer
+	// write writes the line of a commit.
+	write func(CommitRecord) error
+	err   error
+}
+
+// OpenCommitLog opens the jsonl log at path, or stdout if path is "-". An
+// existing file is truncated, unless appending. Paths ending in .gz are
+// gzipped, each run appending a gzip member of its own.
+func OpenCommitLog(path string, appending bool) (*CommitLog, error) {
+	return openCommitLog(path, appending, func(w io.Writer) (func(CommitRecord) error, error) {
+		enc := json.NewEncoder(w)
+		// keep "Name <email>" readable
+		enc.SetEscapeHTML(false)
+		return func(cmt CommitRecord) error {
+			return enc.Encode(commitLine{Repo: cmt.Repo, Hash: cmt.Hash, Author: cmt.Author, Subject: cmt.Subject,
+				Reviewers: cmt.Reviewers, Date: cmt.Date, Parents: cmt.Parents})
+		}, nil
+	})
+}
+
+// OpenCommitsCSV opens a log at path writing the rows of WriteCommits, in
+// the order commits are counted rather than by date, with their repo if
+// withRepo is set.
+func OpenCommitsCSV(path string, withRepo bool) (*CommitLog, error) {
+	return openCommitLog(path, false, func(w io.Writer) (func(CommitRecord) error, error) {
+		cw := csv.NewWriter(w)
+		write := func(rec []string) error {
+			cw.Write(rec)
+			cw.Flush()
+			return cw.Error()
+		}
+		if err := write(commitsHeader(withRepo)); err != nil {
+			return nil, err
+		}
+		return func(cmt CommitRecord) error { return write(commitRow(cmt, withRepo)) }, nil
+	})
+}
+
+// openCommitLog opens the log at path, writing lines through what newWrite
+// returns for the, maybe gzipped, file.
+func openCommitLog(path string, appending bool, newWrite func(io.Writer) (func(CommitRecord) error, error)) (*CommitLog, error) {
+	l := &CommitLog{}
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if appending {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(path, flags, 0644)
+		if err != nil {
+			return nil, err
+		}
+		l.f, w = f, f
+		if isGzipPath(path) {
+			l.zw = gzip.NewWriter(f)
+			w = l.zw
+		}
+	}
+	var err error
+	if l.write, err = newWrite(w); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Write writes the line of cmt. Once a write fails the following ones are
+// dropped and Close returns the error. Gzipped lines are flushed one by one,
+// so they still survive the run failing.
+func (l *CommitLog) Write(cmt CommitRecord) {
+	if l.err != nil {
+		return
+	}
+	defer func() {
+		if l.err == nil && l.zw != nil {
+			l.err = l.zw.Flush()
+		}
+	}()
+	l.err = l.write(cmt)
+}
+
+// Close closes the log and returns the first error writing it.
+func (l *CommitLog) Close() error {
+	if l.zw != nil {
+		if err := l.zw.Close(); l.err == nil {
+			l.err = err
+		}
+		l.zw = nil
+	}
+	if l.f != nil {
+		if err := l.f.Close(); l.err == nil {
+			l.err = err
+		}
+		l.f = nil
+	}
+	return l.err
+}
@@ -0,0 +1,78 @@
+package contrib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readCommitLines reads back the jsonl log at path, failing t on a line that
+// isn't a commit.
+func readCommitLines(t *testing.T, path string) []commitLine {
+	t.Helper()
+	b, err := readOutputFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []commitLine
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		var l commitLine
+		if err := json.Unmarshal(s.Bytes(), &l); err != nil {
+			t.Fatalf("line %d, %q: %v", len(lines)+1, s.Text(), err)
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// scrapeToLog scrapes opts, writing each commit to the jsonl log at path.
+func scrapeToLog(t *testing.T, opts Options, path string, appending bool) {
+	t.Helper()
+	l, err := OpenCommitLog(path, appending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Commit = l.Write
+	scrape(t, opts)
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommitLog(t *testing.T) {
+	for _, name := range []string{"commits.jsonl", "commits.jsonl.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			opts := offlineRepo(t, selfReviewed()...)
+			scrapeToLog(t, opts, path, false)
+
+			lines := readCommitLines(t, path)
+			if len(lines) != 2 {
+				t.Fatalf("got %d lines, want one per commit", len(lines))
+			}
+			l := lines[0]
+			if l.Hash != "c2f0" || l.Author != "Jane Doe <jdoe@chromium.org>" || l.Subject != "Land my own change" ||
+				len(l.Reviewers) != 2 || l.Reviewers[1] != "John Roe <jroe@chromium.org>" ||
+				len(l.Parents) != 1 || l.Parents[0] != "c1f0" {
+				t.Errorf("first line = %+v", l)
+			}
+			if want := time.Date(2021, time.March, 1, 17, 30, 0, 0, time.UTC); !l.Date.Equal(want) {
+				t.Errorf("date = %v, want %v", l.Date, want)
+			}
+
+			// another run adds its lines, truncating only without append
+			scrapeToLog(t, opts, path, true)
+			if n := len(readCommitLines(t, path)); n != 4 {
+				t.Errorf("got %d lines after appending a run, want 4", n)
+			}
+			scrapeToLog(t, opts, path, false)
+			if n := len(readCommitLines(t, path)); n != 2 {
+				t.Errorf("got %d lines after a run not appending, want 2", n)
+			}
+		})
+	}
+}
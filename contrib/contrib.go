@@ -0,0 +1,536 @@
+// Package contrib collects contribution statistics by walking the commit
+// history of a gitiles repository in a browser driven over the devtools
+// protocol, or by querying the Gerrit instance reviewing it.
+package contrib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Contribution counts what a single contributor did in the scraped commits.
+type Contribution struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Reviewed int    `json:"reviewed"`
+	// Created is fractional when the credit of commits is split between
+	// their co-authors.
+	Created    float64 `json:"created"`
+	Committed  int     `json:"committed"`
+	SignedOff  int     `json:"signed_off"`
+	Tested     int     `json:"tested"`
+	CoAuthored int     `json:"co_authored"`
+	// Insertions and Deletions are the lines changed by the commits
+	// authored, as their pages show them. Commits read from a log listing
+	// change none unless Options.CommitPages is set.
+	Insertions int `json:"insertions"`
+	Deletions  int `json:"deletions"`
+	// Buckets counts the commits naming the contributor in the trailers
+	// mapped to each bucket by Options.TrailerBuckets.
+	Buckets map[string]int `json:"buckets,omitempty"`
+	// FirstCommit and LastCommit are the dates of the earliest and latest
+	// commits authored, zero for those who authored none.
+	FirstCommit time.Time `json:"first_commit"`
+	LastCommit  time.Time `json:"last_commit"`
+}
+
+// noteCommit widens the commit dates of c to include date.
+func (c *Contribution) noteCommit(date time.Time) {
+	if date.IsZero() {
+		return
+	}
+	if c.FirstCommit.IsZero() || date.Before(c.FirstCommit) {
+		c.FirstCommit = date
+	}
+	if date.After(c.LastCommit) {
+		c.LastCommit = date
+	}
+}
+
+// Options configures a Scrape.
+type Options struct {
+	// Backend is where commits are read from: "cdp" (the default) scrapes
+	// the pages of RepoURL in a browser, "gerrit" queries the REST api of
+	// the Gerrit instance reviewing RepoURL.
+	Backend string
+	// GerritURL is the Gerrit instance of the "gerrit" backend. If empty,
+	// it's derived from RepoURL following the googlesource.com naming.
+	GerritURL string
+
+	// HTMLDir, if set, is a directory of saved pages the "cdp" backend
+	// reads instead of driving a browser. See dirPages for how pages are
+	// found.
+	HTMLDir string
+
+	// DevTools is the devtools endpoint of the browser to drive.
+	DevTools string
+	// Launch starts a headless chrome on DevTools instead of using a
+	// running one.
+	Launch bool
+	// NewTab opens a tab of its own to navigate instead of the one found
+	// open, so several scrapes can share the browser.
+	NewTab bool
+
+	// UserAgent, if set, is the user agent the browser navigates with
+	// instead of its own.
+	UserAgent string
+	// Cookies, by name, are sent to the host of RepoURL, or to GerritURL
+	// on the "gerrit" backend, and Headers along with every request, to
+	// reach instances behind authentication.
+	Cookies map[string]string
+	Headers map[string]string
+
+	// RepoURL and Branch select the history to walk. Branch can also be a
+	// tag, as refs/tags/<name>, or a full commit hash to walk from.
+	RepoURL string
+	Branch  string
+	// Source reads the pages of RepoURL. If nil, it's picked from the
+	// host of RepoURL.
+	Source Source
+
+	// Count is the number of commits to scrape, 0 for no limit.
+	Count int
+	// UntilCommit stops the walk at the commit with this (possibly
+	// abbreviated) hash, without counting it.
+	UntilCommit string
+	// Since and Until restrict counting to commits authored in between,
+	// both inclusive. The walk stops at the first commit before Since,
+	// which the "gerrit" backend, not in the order of history, can't do.
+	// Zero values leave that side open.
+	Since, Until time.Time
+
+	// Path, if set, walks the history of the files under this path of the
+	// repository alone, as the log listing of the path tells it. It needs a
+	// source with log listings.
+	Path string
+	// IncludePath, if set, restricts counting to the commits changing a
+	// file under this path prefix. The commits around them are still
+	// walked through.
+	IncludePath string
+	// CommitPages reads every commit from its own page even when a log
+	// lists it, for what only commit pages show: the diffstat and the files
+	// changed. IncludePath implies it.
+	CommitPages bool
+
+	// CommitsPath is the directory each commit is written to, created if
+	// missing. When empty no commit files are written.
+	CommitsPath string
+	// CommitFormat is the format of the commit files, "text" (the
+	// default) for the bare message or "json" for the whole CommitRecord.
+	CommitFormat string
+	// GzipCommits gzips the commit files, named with a .gz suffix.
+	GzipCommits bool
+	// StripTrailers leaves the trailers out of the messages written to
+	// the commit files. They're still counted.
+	StripTrailers bool
+	// MaxCommitBytes, if above 0, cuts longer messages short in commit
+	// files. Trailers are still read from the whole message.
+	MaxCommitBytes int
+	// ScreenshotDir, if set, is where a screenshot of the page each commit
+	// is read from is saved as <hash>.png, for debugging extraction. It's
+	// created if missing.
+	ScreenshotDir string
+
+	// CacheDir, if set, is where fetched pages are cached. Refresh
+	// ignores and overwrites what is already cached.
+	CacheDir string
+	Refresh  bool
+	// Retries is how many times a page that failed to load is retried.
+	Retries int
+	// CommitTimeout, if set, is the time each commit is expected to take
+	// at most. Commits coming close to it are logged; the run as a whole is
+	// bounded by the context of the scrape.
+	CommitTimeout time.Duration
+	// PageTimeout bounds loading a single page, retries aside. Zero
+	// leaves pages bounded by the context of the scrape only.
+	PageTimeout time.Duration
+	// WaitSelector, if set, is a css selector of an element pages are
+	// given up to WaitTimeout to show up after their DOM content is loaded,
+	// for content inserted late.
+	WaitSelector string
+	WaitTimeout  time.Duration
+	// Concurrency is how many commit pages are read at once, each in a tab
+	// of its own. Above 1 it needs a source that lists commits in a log.
+	Concurrency int
+	// Rate is the most pages navigated to per second, zero for no limit.
+	// Pages served from CacheDir don't count.
+	Rate float64
+
+	// WaitFor is the event taking a page for loaded: "domcontent" (the
+	// default), "load" or "networkidle".
+	WaitFor string
+	// ReviewerKeys are trailer keys read as reviewers besides Reviewed-by,
+	// like "R=", whose lines may list several separated by commas.
+	ReviewerKeys []string
+	// TrailerBuckets maps trailer keys, like "Acked-by:", to the bucket
+	// the contributors they name are counted in, like "acked". Buckets
+	// are output as columns of their own.
+	TrailerBuckets map[string]string
+
+	// NoSelfReview drops the reviews authors gave their own commits. By
+	// default they're counted like any other review.
+	NoSelfReview bool
+
+	// SplitCredit divides the created credit of a commit evenly between
+	// its author and co-authors.
+	SplitCredit bool
+
+	// SkipErrors logs and skips commits whose page can't be parsed
+	// instead of failing the whole scrape.
+	SkipErrors bool
+
+	// ResolveNames counts the people named without an email, like in some
+	// trailers, under the contributor with an email going by that name.
+	ResolveNames bool
+
+	// Aliases maps alias emails to the canonical one to count them under.
+	Aliases map[string]string
+
+	// Bots are patterns of contributors left out of the counts, in
+	// whatever role. See DefaultBots.
+	Bots []string
+
+	// Checkpoint, if set, is a file the state of the walk is saved to
+	// every CheckpointEvery counted commits and when it stops early, so a
+	// later Scrape resumes where it left off rather than at the tip. It's
+	// removed once the walk finishes. Restart ignores the one there is.
+	// Walks resume after the last commit they were done with, the one
+	// counted or skipped before the checkpoint was saved.
+	Checkpoint      string
+	CheckpointEvery int
+	Restart         bool
+
+	// Commit, if set, is called with each counted commit.
+	Commit func(CommitRecord)
+
+	// Progress, if set, is called after each counted commit with the
+	// number counted so far and Count.
+	Progress func(done, total int)
+}
+
+// ErrIncomplete is returned along with the contributions gathered so far when
+// the context is done before the walk finishes.
+var ErrIncomplete = errors.New("scrape incomplete")
+
+func incomplete(ctx context.Context) error {
+	return fmt.Errorf("%w: %v", ErrIncomplete, ctx.Err())
+}
+
+// commitIter yields the commits of the history, newest first. It returns
+// io.EOF once history is exhausted, and a *parseError for commits that were
+// reached but can't be read.
+type commitIter interface {
+	next() (CommitRecord, error)
+}
+
+type parseError struct {
+	hash string
+	err  error
+}
+
+func (e *parseError) Error() string { return e.err.Error() }
+func (e *parseError) Unwrap() error { return e.err }
+
+// HasBackend reports whether Options.Backend can be backend.
+func HasBackend(backend string) bool {
+	return backend == "" || backend == "cdp" || backend == "gerrit"
+}
+
+// Scrape walks the history described by opts and returns the contributions
+// found, keyed by contributor. If ctx is done midway, the contributions of the
+// commits scraped until then are returned with an ErrIncomplete error.
+func Scrape(ctx context.Context, opts Options) (map[string]Contribution, error) {
+	var cp *checkpoint
+	if opts.Checkpoint != "" && !opts.Restart {
+		var err error
+		if cp, err = loadCheckpoint(opts.Checkpoint, opts); err != nil {
+			return nil, err
+		}
+	}
+	start := ""
+	if cp != nil {
+		start = cp.Last
+	}
+
+	var commits commitIter
+	switch opts.Backend {
+	case "", "cdp":
+		if opts.HTMLDir != "" {
+			var err error
+			if commits, err = offlineCommits(opts, start); err != nil {
+				return nil, err
+			}
+			break
+		}
+		b, err := openBrowser(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		defer b.close()
+
+		if commits, err = b.commits(ctx, opts, start); err != nil {
+			return nil, err
+		}
+	case "gerrit":
+		if opts.Checkpoint != "" {
+			return nil, fmt.Errorf("the gerrit backend can't resume from checkpoints")
+		}
+		if !opts.Since.IsZero() {
+			// its changes are not in the order of history to stop at Since
+			return nil, fmt.Errorf("the gerrit backend can't stop at a since date")
+		}
+		if !IsBranchName(opts.Branch) {
+			return nil, fmt.Errorf("the gerrit backend can only query branches, not %s", opts.Branch)
+		}
+		g, err := newGerritCommits(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		commits = g
+	default:
+		return nil, fmt.Errorf("unknown backend %q", opts.Backend)
+	}
+
+	conts, err := collect(ctx, commits, opts, cp)
+	if opts.ResolveNames && conts != nil {
+		resolveNames(conts)
+	}
+	return conts, err
+}
+
+// ScrapeStream walks the history like Scrape, sending each counted commit on
+// the first channel as it's reached. That channel is closed once the walk
+// ends, then the error of the walk, if any, is sent on the second one before
+// it's closed too. Cancelling ctx stops the walk.
+func ScrapeStream(ctx context.Context, opts Options) (<-chan CommitRecord, <-chan error) {
+	cmts := make(chan CommitRecord)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		commit := opts.Commit
+		opts.Commit = func(cmt CommitRecord) {
+			if commit != nil {
+				commit(cmt)
+			}
+			select {
+			case cmts <- cmt:
+			case <-ctx.Done():
+			}
+		}
+		_, err := Scrape(ctx, opts)
+		close(cmts)
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return cmts, errc
+}
+
+// slowCommitShare is the percentage of Options.CommitTimeout past which a
+// commit is logged as slow.
+const slowCommitShare = 80
+
+// collect counts the contributions of the commits that opts selects, going on
+// from cp if set.
+func collect(ctx context.Context, commits commitIter, opts Options, cp *checkpoint) (conts map[string]Contribution, err error) {
+	if opts.CommitsPath != "" {
+		if err := os.MkdirAll(opts.CommitsPath, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	t := newTally(opts.Aliases, opts.Bots)
+	visited := make(map[string]bool)
+	n := 0
+	if cp != nil {
+		for k, c := range cp.Contributions {
+			t.conts[k] = c
+		}
+		for _, h := range cp.Visited {
+			visited[h] = true
+		}
+		n = cp.Counted
+	}
+	// last is the commit the walk would resume after, the one it starts at
+	// when resuming being skipped
+	last, skip := "", ""
+	if cp != nil {
+		last, skip = cp.Last, cp.Last
+	}
+	done := func(hash string) {
+		visited[hash] = true
+		last = hash
+	}
+	if opts.Checkpoint != "" {
+		defer func() {
+			if err == nil {
+				if rerr := os.Remove(opts.Checkpoint); rerr != nil && !os.IsNotExist(rerr) {
+					slog.Warn("can't remove checkpoint", "path", opts.Checkpoint, "err", rerr)
+				}
+				return
+			}
+			if last == "" {
+				return
+			}
+			if serr := saveCheckpoint(opts, last, n, visited, t.conts); serr != nil {
+				slog.Warn("can't save checkpoint", "path", opts.Checkpoint, "err", serr)
+			}
+		}()
+	}
+	var skipped []string
+	defer func() {
+		if len(skipped) > 0 {
+			slog.Warn("skipped commits", "count", len(skipped), "commits", strings.Join(skipped, ", "))
+		}
+	}()
+
+	for opts.Count <= 0 || n < opts.Count {
+		if ctx.Err() != nil {
+			return t.conts, incomplete(ctx)
+		}
+
+		// fetch commit
+		start := time.Now()
+		cmt, err := commits.next()
+		// the end of the history isn't a commit
+		took := time.Since(start)
+		if err != io.EOF && opts.CommitTimeout > 0 && took >= opts.CommitTimeout*slowCommitShare/100 {
+			slog.Warn("commit close to its time budget", "commit", cmt.Hash, "took", took.Round(time.Millisecond),
+				"budget", opts.CommitTimeout)
+		}
+		if err == io.EOF {
+			if opts.Count > 0 {
+				slog.Info("history ended before counting all the commits asked for", "asked", opts.Count, "counted", n)
+			}
+			break
+		}
+		var perr *parseError
+		if errors.As(err, &perr) && opts.SkipErrors {
+			id := perr.hash
+			if id == "" {
+				id = "unknown commit"
+			}
+			slog.Warn("skipping commit", "commit", id, "err", perr.err)
+			skipped = append(skipped, id)
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return t.conts, incomplete(ctx)
+			}
+			return nil, err
+		}
+
+		slog.Debug("fetched commit", "commit", cmt.Hash, "author", cmt.Author)
+		if cmt.Hash == skip {
+			// done with before the checkpoint was saved
+			skip = ""
+			continue
+		}
+		if visited[cmt.Hash] {
+			// the rest of this line of history was counted already
+			break
+		}
+		if opts.UntilCommit != "" && strings.HasPrefix(cmt.Hash, opts.UntilCommit) {
+			break
+		}
+		if !opts.Since.IsZero() && cmt.Date.Before(opts.Since) {
+			break
+		}
+		if !opts.Until.IsZero() && cmt.Date.After(opts.Until) {
+			done(cmt.Hash)
+			continue
+		}
+		if opts.IncludePath != "" && !touchesPath(cmt.Files, opts.IncludePath) {
+			done(cmt.Hash)
+			continue
+		}
+
+		if len(opts.ReviewerKeys) > 0 {
+			cmt.Reviewers = appendNew(cmt.Reviewers, getListTrailers(cmt.Message, opts.ReviewerKeys))
+		}
+		if len(opts.TrailerBuckets) > 0 {
+			cmt.Buckets = getBuckets(cmt.Message, opts.TrailerBuckets)
+		}
+		if opts.NoSelfReview {
+			reviewers := make([]string, 0, len(cmt.Reviewers))
+			for _, r := range cmt.Reviewers {
+				if !t.sameContributor(r, cmt.Author) {
+					reviewers = append(reviewers, r)
+				}
+			}
+			cmt.Reviewers = reviewers
+		}
+
+		// write commit file, before counting so a checkpoint saved when it
+		// fails leaves the commit to the run resuming
+		if opts.CommitsPath != "" {
+			if err = writeCommitFile(opts, cmt); err != nil {
+				return nil, err
+			}
+		}
+		n++
+		t.count(cmt, opts.SplitCredit)
+		done(cmt.Hash)
+
+		if opts.Commit != nil {
+			opts.Commit(cmt)
+		}
+		if opts.Progress != nil {
+			opts.Progress(n, opts.Count)
+		}
+		if opts.Checkpoint != "" && opts.CheckpointEvery > 0 && n%opts.CheckpointEvery == 0 {
+			if err = saveCheckpoint(opts, last, n, visited, t.conts); err != nil {
+				return nil, fmt.Errorf("can't save checkpoint: %v", err)
+			}
+		}
+	}
+
+	return t.conts, nil
+}
+
+// touchesPath reports whether one of files is prefix or under it.
+func touchesPath(files []string, prefix string) bool {
+	prefix = strings.Trim(prefix, "/")
+	for _, f := range files {
+		f = strings.TrimPrefix(f, "/")
+		if prefix == "" || f == prefix || strings.HasPrefix(f, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func saveCheckpoint(opts Options, last string, counted int, visited map[string]bool, conts map[string]Contribution) error {
+	cp := checkpoint{RepoURL: opts.RepoURL, Branch: opts.Branch, Last: last, Counted: counted,
+		Visited: make([]string, 0, len(visited)), Contributions: conts}
+	for h := range visited {
+		cp.Visited = append(cp.Visited, h)
+	}
+	sort.Strings(cp.Visited)
+	return cp.save(opts.Checkpoint)
+}
+
+// appendNew appends the elements of vals missing from s.
+func appendNew(s, vals []string) []string {
+	for _, v := range vals {
+		found := false
+		for _, e := range s {
+			if e == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s = append(s, v)
+		}
+	}
+	return s
+}
@@ -0,0 +1,528 @@
+package contrib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// tests checking logs set their own handler
+	slog.SetDefault(slog.New(slog.NewTextHandler(ioutil.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+const testRepo = "https://chromium.googlesource.com/chromiumos/platform/tast-tests"
+
+const testDate = "Mon Mar 01 09:30:00 2021 -0800"
+
+// testCommit is a commit of a made up gitiles history.
+type testCommit struct {
+	hash   string
+	author string
+	// committer and date default to the author and testDate.
+	committer string
+	date      string
+	parents   []string
+	msg       string
+	files     []string
+	diffstat  string
+}
+
+// linear has each of cmts be the parent of the one before it, the last one
+// being the root.
+func linear(cmts ...testCommit) []testCommit {
+	for i := range cmts {
+		cmts[i].parents = nil
+		if i+1 < len(cmts) {
+			cmts[i].parents = []string{cmts[i+1].hash}
+		}
+	}
+	return cmts
+}
+
+// commitPage renders c the way gitiles shows commit pages.
+func commitPage(c testCommit) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<!DOCTYPE html><html lang="en"><head><meta charset="utf-8"><title>%s</title></head>`, c.hash)
+	b.WriteString(`<body class="Site">`)
+	writeCommitMetadata(&b, c)
+	if len(c.files) > 0 {
+		b.WriteString(`<ul class="DiffTree">`)
+		for _, f := range c.files {
+			fmt.Fprintf(&b, `<li><a href="/chromiumos/platform/tast-tests/+/%s/%s">%s</a></li>`, c.hash, f, f)
+		}
+		b.WriteString(`</ul>`)
+	}
+	if c.diffstat != "" {
+		fmt.Fprintf(&b, `<div class="DiffSummary">%s</div>`, c.diffstat)
+	}
+	b.WriteString(`</body></html>`)
+	return b.String()
+}
+
+// writeCommitMetadata writes the rows and message of c, which both commit
+// pages and full log listings show.
+func writeCommitMetadata(b *strings.Builder, c testCommit) {
+	committer, date := c.committer, c.date
+	if committer == "" {
+		committer = c.author
+	}
+	if date == "" {
+		date = testDate
+	}
+	b.WriteString(`<div class="u-monospace Metadata"><table>`)
+	fmt.Fprintf(b, `<tr><th class="Metadata-title">commit</th><td>%s</td><td></td></tr>`, c.hash)
+	fmt.Fprintf(b, `<tr><th class="Metadata-title">author</th><td>%s</td><td>%s</td></tr>`, html.EscapeString(c.author), date)
+	fmt.Fprintf(b, `<tr><th class="Metadata-title">committer</th><td>%s</td><td>%s</td></tr>`, html.EscapeString(committer), date)
+	for _, p := range c.parents {
+		fmt.Fprintf(b, `<tr><th class="Metadata-title">parent</th><td><a href="/chromiumos/platform/tast-tests/+/%s">%s</a></td></tr>`, p, p)
+	}
+	fmt.Fprintf(b, `</table></div><pre class="u-pre u-monospace MetadataMessage">%s</pre>`, html.EscapeString(c.msg))
+}
+
+// logPage renders the gitiles log listing of cmts as ?pretty=full shows it,
+// with their messages but not what only commit pages show, linking to the
+// page at next if it's set.
+func logPage(cmts []testCommit, next string) string {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html><html lang="en"><head><meta charset="utf-8"><title>log</title></head><body class="Site"><ol class="CommitLog">`)
+	for _, c := range cmts {
+		fmt.Fprintf(&b, `<li class="CommitLog-item"><a class="u-sha1 u-monospace CommitLog-sha1" href="/chromiumos/platform/tast-tests/+/%s">%.7s</a>`, c.hash, c.hash)
+		writeCommitMetadata(&b, c)
+		b.WriteString(`</li>`)
+	}
+	b.WriteString(`</ol>`)
+	if next != "" {
+		fmt.Fprintf(&b, `<nav class="LogNav"><a class="LogNav-next" href="%s">Next &raquo;</a></nav>`, html.EscapeString(next))
+	}
+	b.WriteString(`</body></html>`)
+	return b.String()
+}
+
+// offlineRepo saves the pages of cmts in a temporary directory, the first
+// one at the tip of main, and returns the options scraping them from there.
+func offlineRepo(t testing.TB, cmts ...testCommit) Options {
+	t.Helper()
+	dir := t.TempDir()
+	for _, c := range cmts {
+		writeTestFile(t, filepath.Join(dir, c.hash+".html"), commitPage(c))
+	}
+	if len(cmts) > 0 {
+		manifest, err := json.Marshal(map[string]string{testRepo + "/+/refs/heads/main": cmts[0].hash + ".html"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, filepath.Join(dir, manifestFile), string(manifest))
+	}
+	return Options{HTMLDir: dir, RepoURL: testRepo, Branch: "main", Source: Gitiles, Count: 100}
+}
+
+func writeTestFile(t testing.TB, path, data string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// scrape runs Scrape over opts, failing t on errors.
+func scrape(t testing.TB, opts Options) map[string]Contribution {
+	t.Helper()
+	conts, err := Scrape(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Scrape: %v", err)
+	}
+	return conts
+}
+
+func TestScrapeCountsEveryCommit(t *testing.T) {
+	jane := "Jane Doe <jdoe@chromium.org>"
+	opts := offlineRepo(t, linear(
+		testCommit{hash: "c3", author: jane, msg: "Third\n"},
+		testCommit{hash: "c2", author: jane, msg: "Second\n"},
+		testCommit{hash: "c1", author: jane, msg: "First\n"},
+	)...)
+
+	conts := scrape(t, opts)
+	c, ok := conts["jdoe@chromium.org"]
+	if !ok {
+		t.Fatalf("no contribution of jdoe@chromium.org in %v", conts)
+	}
+	if c.Created != 3 {
+		t.Errorf("Created = %v, want 3", c.Created)
+	}
+	if len(conts) != 1 {
+		t.Errorf("got %d contributors, want 1: %v", len(conts), conts)
+	}
+}
+
+func TestScrapeCountsReviewers(t *testing.T) {
+	opts := offlineRepo(t, testCommit{
+		hash:   "c1",
+		author: "Jane Doe <jdoe@chromium.org>",
+		msg:    "Add a widget\n\nReviewed-by: John Roe <jroe@chromium.org>\nReviewed-by: Alex Poe <apoe@google.com>\n",
+	})
+
+	conts := scrape(t, opts)
+	for _, k := range []string{"jroe@chromium.org", "apoe@google.com"} {
+		c := conts[k]
+		if c.Reviewed != 1 || c.Created != 0 {
+			t.Errorf("%s: Reviewed = %d, Created = %v, want 1, 0", k, c.Reviewed, c.Created)
+		}
+	}
+	if c := conts["jdoe@chromium.org"]; c.Reviewed != 0 || c.Created != 1 {
+		t.Errorf("author: Reviewed = %d, Created = %v, want 0, 1", c.Reviewed, c.Created)
+	}
+}
+
+// fiveCommits is a linear history of commits by as many authors, the newest
+// first.
+func fiveCommits() []testCommit {
+	return linear(
+		testCommit{hash: "e5f0", author: "E <e@chromium.org>", msg: "Fifth\n"},
+		testCommit{hash: "d4f0", author: "D <d@chromium.org>", msg: "Fourth\n"},
+		testCommit{hash: "c3f0", author: "C <c@chromium.org>", msg: "Third\n"},
+		testCommit{hash: "b2f0", author: "B <b@chromium.org>", msg: "Second\n"},
+		testCommit{hash: "a1f0", author: "A <a@chromium.org>", msg: "First\n"},
+	)
+}
+
+// authors returns the sorted keys of the contributors who created something
+// in conts.
+func authors(conts map[string]Contribution) string {
+	var keys []string
+	for k, c := range conts {
+		if c.Created > 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, " ")
+}
+
+func TestScrapeUntilCommit(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		until string
+		count int
+		want  string
+	}{
+		{"abbreviated", "c3", 100, "d@chromium.org e@chromium.org"},
+		{"full", "b2f0", 100, "c@chromium.org d@chromium.org e@chromium.org"},
+		{"count first", "b2", 1, "e@chromium.org"},
+		{"tip", "e5", 100, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := offlineRepo(t, fiveCommits()...)
+			opts.UntilCommit, opts.Count = tc.until, tc.count
+			if got := authors(scrape(t, opts)); got != tc.want {
+				t.Errorf("counted %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScrapeCountsCommitters(t *testing.T) {
+	opts := offlineRepo(t, linear(
+		testCommit{hash: "c2", author: "Jane Doe <jdoe@chromium.org>", committer: "John Roe <jroe@chromium.org>",
+			msg: "Picked by John\n"},
+		testCommit{hash: "c1", author: "John Roe <jroe@chromium.org>", msg: "His own\n"},
+	)...)
+
+	conts := scrape(t, opts)
+	if c := conts["jdoe@chromium.org"]; c.Created != 1 || c.Committed != 0 {
+		t.Errorf("author: Created = %v, Committed = %d, want 1, 0", c.Created, c.Committed)
+	}
+	if c := conts["jroe@chromium.org"]; c.Created != 1 || c.Committed != 2 {
+		t.Errorf("committer: Created = %v, Committed = %d, want 1, 2", c.Created, c.Committed)
+	}
+}
+
+func TestScrapeDateRange(t *testing.T) {
+	opts := offlineRepo(t, linear(
+		testCommit{hash: "c6", author: "F <f@chromium.org>", date: "Wed Mar 03 00:00:00 2021 +0000", msg: "After\n"},
+		testCommit{hash: "c5", author: "E <e@chromium.org>", date: "Tue Mar 02 23:59:59 2021 +0000", msg: "Until\n"},
+		testCommit{hash: "c4", author: "D <d@chromium.org>", date: "Mon Mar 01 12:00:00 2021 +0000", msg: "Within\n"},
+		testCommit{hash: "c3", author: "C <c@chromium.org>", date: "Sun Feb 28 00:00:00 2021 +0000", msg: "Since\n"},
+		testCommit{hash: "c2", author: "B <b@chromium.org>", date: "Sat Feb 27 23:59:59 2021 +0000", msg: "Before\n"},
+		// out of order, but past the commit before the range
+		testCommit{hash: "c1", author: "A <a@chromium.org>", date: "Mon Mar 01 12:00:00 2021 +0000", msg: "Late\n"},
+	)...)
+	opts.Since = time.Date(2021, 2, 28, 0, 0, 0, 0, time.UTC)
+	opts.Until = time.Date(2021, 3, 3, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond)
+
+	if got, want := authors(scrape(t, opts)), "c@chromium.org d@chromium.org e@chromium.org"; got != want {
+		t.Errorf("counted %q, want %q", got, want)
+	}
+}
+
+func TestScrapeReturnsPartialResults(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := offlineRepo(t, fiveCommits()...)
+	n := 0
+	opts.Commit = func(CommitRecord) {
+		if n++; n == 2 {
+			cancel()
+		}
+	}
+
+	conts, err := Scrape(ctx, opts)
+	if !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("err = %v, want ErrIncomplete", err)
+	}
+	path := filepath.Join(t.TempDir(), "out.csv")
+	if err = WriteOutput(conts, path, OutputOptions{Format: "csv", Sort: "name"}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := readCSV(t, string(b), ',')
+	if len(recs) != 3 || recs[1][1] != "d@chromium.org" || recs[2][1] != "e@chromium.org" {
+		t.Errorf("wrote %q, want the two commits scraped", recs)
+	}
+}
+
+func TestScrapeSkipErrors(t *testing.T) {
+	cmts := fiveCommits()
+	// the page of c3f0 lacks an author
+	cmts[2].author = ""
+
+	opts := offlineRepo(t, cmts...)
+	if _, err := Scrape(context.Background(), opts); err == nil {
+		t.Error("Scrape of a broken page succeeded without SkipErrors")
+	}
+
+	opts.SkipErrors = true
+	conts := scrape(t, opts)
+	if got, want := authors(conts), "a@chromium.org b@chromium.org d@chromium.org e@chromium.org"; got != want {
+		t.Errorf("counted %q, want %q", got, want)
+	}
+}
+
+func TestScrapeCoAuthors(t *testing.T) {
+	cmts := linear(
+		testCommit{hash: "c2", author: "Jane Doe <jdoe@chromium.org>",
+			msg: "Pair on it\n\nCo-authored-by: John Roe <jroe@chromium.org>\nCo-authored-by: Alex Poe <apoe@google.com>\n"},
+		testCommit{hash: "c1", author: "John Roe <jroe@chromium.org>", msg: "Alone\n"},
+	)
+	for _, tc := range []struct {
+		split bool
+		// created counts of jdoe, jroe and apoe
+		want [3]float64
+	}{
+		{false, [3]float64{1, 1, 0}},
+		{true, [3]float64{1.0 / 3, 1 + 1.0/3, 1.0 / 3}},
+	} {
+		t.Run(fmt.Sprint("split=", tc.split), func(t *testing.T) {
+			opts := offlineRepo(t, cmts...)
+			opts.SplitCredit = tc.split
+			conts := scrape(t, opts)
+			for i, k := range []string{"jdoe@chromium.org", "jroe@chromium.org", "apoe@google.com"} {
+				c := conts[k]
+				if math.Abs(c.Created-tc.want[i]) > 1e-9 {
+					t.Errorf("%s: Created = %v, want %v", k, c.Created, tc.want[i])
+				}
+				if want := []int{0, 1, 1}[i]; c.CoAuthored != want {
+					t.Errorf("%s: CoAuthored = %d, want %d", k, c.CoAuthored, want)
+				}
+			}
+		})
+	}
+}
+
+func TestScrapeDiamond(t *testing.T) {
+	// d merges b and c, which both branch off a
+	opts := offlineRepo(t,
+		testCommit{hash: "d4f0", author: "D <d@chromium.org>", parents: []string{"b2f0", "c3f0"}, msg: "Merge\n"},
+		testCommit{hash: "b2f0", author: "B <b@chromium.org>", parents: []string{"a1f0"}, msg: "Left\n"},
+		testCommit{hash: "c3f0", author: "C <c@chromium.org>", parents: []string{"a1f0"}, msg: "Right\n"},
+		testCommit{hash: "a1f0", author: "A <a@chromium.org>", msg: "Base\n"},
+	)
+	var seen []string
+	opts.Commit = func(cmt CommitRecord) { seen = append(seen, cmt.Hash) }
+
+	conts := scrape(t, opts)
+	if got, want := strings.Join(seen, " "), "d4f0 b2f0 a1f0"; got != want {
+		t.Errorf("counted commits %q, want %q", got, want)
+	}
+	for k, c := range conts {
+		if c.Created != 1 {
+			t.Errorf("%s: Created = %v, want 1", k, c.Created)
+		}
+	}
+}
+
+func TestScrapeStopsAtVisitedCommit(t *testing.T) {
+	// a broken page of b2f0 links back to the tip
+	opts := offlineRepo(t,
+		testCommit{hash: "c3f0", author: "C <c@chromium.org>", parents: []string{"b2f0"}, msg: "Third\n"},
+		testCommit{hash: "b2f0", author: "B <b@chromium.org>", parents: []string{"c3f0"}, msg: "Second\n"},
+	)
+	conts := scrape(t, opts)
+	if got, want := authors(conts), "b@chromium.org c@chromium.org"; got != want {
+		t.Errorf("counted %q, want %q", got, want)
+	}
+	if c := conts["c@chromium.org"]; c.Created != 1 {
+		t.Errorf("tip counted %v times, want once", c.Created)
+	}
+}
+
+func TestScrapeStreamMatchesScrape(t *testing.T) {
+	opts := offlineRepo(t, fiveCommits()...)
+	var batch []string
+	opts.Commit = func(cmt CommitRecord) { batch = append(batch, cmt.Hash) }
+	scrape(t, opts)
+
+	opts.Commit = nil
+	cmts, errc := ScrapeStream(context.Background(), opts)
+	var streamed []string
+	for cmt := range cmts {
+		streamed = append(streamed, cmt.Hash)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("ScrapeStream: %v", err)
+	}
+	if strings.Join(streamed, " ") != strings.Join(batch, " ") {
+		t.Errorf("streamed %q, want %q", streamed, batch)
+	}
+}
+
+func TestScrapeStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmts, errc := ScrapeStream(ctx, offlineRepo(t, fiveCommits()...))
+	if _, ok := <-cmts; !ok {
+		t.Fatal("no commit streamed")
+	}
+	cancel()
+	// the commits already on their way may still come
+	for range cmts {
+	}
+	if err := <-errc; !errors.Is(err, ErrIncomplete) {
+		t.Errorf("err = %v, want ErrIncomplete", err)
+	}
+	if _, ok := <-errc; ok {
+		t.Error("error channel not closed")
+	}
+
+	_, errc = ScrapeStream(context.Background(), Options{HTMLDir: t.TempDir(), RepoURL: testRepo, Branch: "main", Source: Gitiles})
+	if err := <-errc; err == nil {
+		t.Error("ScrapeStream of no pages sent no error")
+	}
+}
+
+// captureLogs has the logs of the test written to the returned buffer.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestScrapeLogsSlowCommits(t *testing.T) {
+	opts := offlineRepo(t, fiveCommits()...)
+	logs := captureLogs(t)
+	opts.CommitTimeout = time.Hour
+	scrape(t, opts)
+	if strings.Contains(logs.String(), "close to its time budget") {
+		t.Errorf("logged commits well within an hour as slow: %s", logs)
+	}
+
+	// every commit takes longer than a nanosecond
+	opts.CommitTimeout = time.Nanosecond
+	scrape(t, opts)
+	if n := strings.Count(logs.String(), "close to its time budget"); n != len(fiveCommits()) {
+		t.Errorf("logged %d slow commits, want all %d: %s", n, len(fiveCommits()), logs)
+	}
+	if !strings.Contains(logs.String(), "commit=c3f0") {
+		t.Error("slow commits are logged without their hash")
+	}
+}
+
+func TestScrapeCountBeyondHistory(t *testing.T) {
+	opts := offlineRepo(t, fiveCommits()...)
+	opts.Count = 50
+	logs := captureLogs(t)
+	conts, err := Scrape(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Scrape = %v, want all of the history counted", err)
+	}
+	if got := authors(conts); got != "a@chromium.org b@chromium.org c@chromium.org d@chromium.org e@chromium.org" {
+		t.Errorf("authors = %s, want all 5", got)
+	}
+	if want := `msg="history ended before counting all the commits asked for" asked=50 counted=5`; !strings.Contains(logs.String(), want) {
+		t.Errorf("logged %s, want %s", logs, want)
+	}
+
+	// not when the history holds just enough
+	logs.Reset()
+	opts.Count = 5
+	scrape(t, opts)
+	if strings.Contains(logs.String(), "history ended") {
+		t.Errorf("logged %s for a count the history holds", logs)
+	}
+}
+
+func TestScrapeIncludePath(t *testing.T) {
+	jane, john := "Jane Doe <jdoe@chromium.org>", "John Roe <jroe@chromium.org>"
+	cmts := linear(
+		testCommit{hash: "c4f0", author: jane, msg: "Docs\n", files: []string{"docs/README.md"}},
+		testCommit{hash: "c3f0", author: john, msg: "Both\n\nReviewed-by: " + jane + "\n",
+			files: []string{"docs/a.md", "src/go/chromiumos/tast/local/x.go"}},
+		testCommit{hash: "c2f0", author: jane, msg: "Elsewhere\n\nReviewed-by: " + john + "\n",
+			files: []string{"src/golden/x.txt"}},
+		testCommit{hash: "c1f0", author: jane, msg: "Local\n", files: []string{"src/go/chromiumos/tast/local/y.go"}},
+	)
+	opts := offlineRepo(t, cmts...)
+	opts.IncludePath = "/src/go/chromiumos/tast/local/"
+	var counted []string
+	opts.Commit = func(cmt CommitRecord) { counted = append(counted, cmt.Hash) }
+	conts := scrape(t, opts)
+
+	// the commits around them are walked through
+	if got := strings.Join(counted, " "); got != "c3f0 c1f0" {
+		t.Errorf("counted %s, want the commits under the path", got)
+	}
+	jd, jr := conts["jdoe@chromium.org"], conts["jroe@chromium.org"]
+	if jd.Created != 1 || jd.Reviewed != 1 || jr.Created != 1 || jr.Reviewed != 0 {
+		t.Errorf("jane %v/%d, john %v/%d, want 1/1 and 1/0", jd.Created, jd.Reviewed, jr.Created, jr.Reviewed)
+	}
+
+	doc := parseString(t, readTestPage(t, "main.html"))
+	if got := strings.Join(Gitiles.(filesSource).Files(doc), " "); got != "src/example/widget.go src/example/widget_data.json" {
+		t.Errorf("files of main.html = %s", got)
+	}
+
+	for _, tc := range []struct {
+		files  []string
+		prefix string
+		want   bool
+	}{
+		{[]string{"src/go/x.go"}, "src", true},
+		{[]string{"src/go/x.go"}, "src/go/x.go", true},
+		{[]string{"srcs/x.go"}, "src", false},
+		{[]string{"/src/x.go"}, "src/", true},
+		{nil, "src", false},
+		{[]string{"x"}, "/", true},
+	} {
+		if got := touchesPath(tc.files, tc.prefix); got != tc.want {
+			t.Errorf("touchesPath(%q, %q) = %v, want %v", tc.files, tc.prefix, got, tc.want)
+		}
+	}
+}
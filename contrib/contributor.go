@@ -0,0 +1,197 @@
+package contrib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// splitContributor splits a "Name <email>" string into its parts. Strings
+// without an email in angle brackets are taken as a bare email if they look
+// like one, like in R= trailers, and as a bare name otherwise.
+func splitContributor(s string) (name, email string) {
+	s = strings.TrimSpace(s)
+	open := strings.LastIndex(s, "<")
+	if open < 0 || !strings.HasSuffix(s, ">") {
+		if strings.Contains(s, "@") && !strings.ContainsAny(s, " \t") {
+			return s, s
+		}
+		return s, ""
+	}
+	return strings.TrimSpace(s[:open]), strings.TrimSpace(s[open+1 : len(s)-1])
+}
+
+// contributorKey is the key a contributor is counted under: the lowercased
+// email, or the name when there's no email.
+func contributorKey(name, email string) string {
+	if email == "" {
+		return name
+	}
+	return strings.ToLower(email)
+}
+
+// DefaultBots matches the automation accounts committing to and reviewing
+// chromium repos.
+var DefaultBots = []string{
+	"*autoroll*@*",
+	"*-bot@*",
+	"*@*.gserviceaccount.com",
+	"commit-bot@chromium.org",
+	"commit bot",
+	"chromium luci cq",
+}
+
+// isBot reports whether the contributor matches one of the bots patterns,
+// globs matched against the lowercased email and name.
+func isBot(name, email string, bots []string) bool {
+	name = strings.ToLower(name)
+	for _, b := range bots {
+		b = strings.ToLower(b)
+		if ok, _ := path.Match(b, email); ok && email != "" {
+			return true
+		}
+		if ok, _ := path.Match(b, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tally accumulates contributions, merging aliased emails into their
+// canonical one and leaving out bots.
+type tally struct {
+	conts   map[string]Contribution
+	aliases map[string]string
+	bots    []string
+}
+
+func newTally(aliases map[string]string, bots []string) *tally {
+	return &tally{conts: make(map[string]Contribution), aliases: aliases, bots: bots}
+}
+
+// resolve splits who into a name and a canonical, lowercased email.
+func (t *tally) resolve(who string) (name, email string) {
+	name, email = splitContributor(who)
+	email = strings.ToLower(email)
+	if canon, ok := t.aliases[email]; ok {
+		email = canon
+	}
+	return name, email
+}
+
+// sameContributor reports whether a and b are counted as the same person.
+func (t *tally) sameContributor(a, b string) bool {
+	return contributorKey(t.resolve(a)) == contributorKey(t.resolve(b))
+}
+
+// add applies f to who's contribution. The first display name seen for an
+// email is the one kept.
+func (t *tally) add(who string, f func(*Contribution)) {
+	name, email := t.resolve(who)
+	if isBot(name, email, t.bots) {
+		return
+	}
+	key := contributorKey(name, email)
+	c := t.conts[key]
+	if c.Name == "" {
+		c.Name = name
+	}
+	c.Email = email
+	f(&c)
+	t.conts[key] = c
+}
+
+// resolveNames merges the contributors known by their name alone into the
+// one contributor with an email going by the same name, in any case. Names
+// shared by several emails are left alone, they can't be told apart.
+func resolveNames(conts map[string]Contribution) {
+	byName := make(map[string]string)
+	for k, c := range conts {
+		if c.Email == "" {
+			continue
+		}
+		name := strings.ToLower(c.Name)
+		if prev, ok := byName[name]; ok && prev != k {
+			byName[name] = ""
+			continue
+		}
+		byName[name] = k
+	}
+	for k, c := range conts {
+		if c.Email != "" {
+			continue
+		}
+		into := byName[strings.ToLower(c.Name)]
+		if into == "" {
+			continue
+		}
+		m := conts[into]
+		m.merge(c)
+		conts[into] = m
+		delete(conts, k)
+	}
+}
+
+// count credits everyone involved in cmt. With splitCredit the created
+// credit is divided between the author and co-authors.
+func (t *tally) count(cmt CommitRecord, splitCredit bool) {
+	credit := 1.0
+	if splitCredit {
+		credit /= float64(1 + len(cmt.CoAuthors))
+	}
+	t.add(cmt.Author, func(c *Contribution) {
+		c.Created += credit
+		c.Insertions += cmt.Insertions
+		c.Deletions += cmt.Deletions
+		c.noteCommit(cmt.Date)
+	})
+	for _, ca := range cmt.CoAuthors {
+		t.add(ca, func(c *Contribution) {
+			c.CoAuthored++
+			if splitCredit {
+				c.Created += credit
+			}
+		})
+	}
+	t.add(cmt.Committer, func(c *Contribution) { c.Committed++ })
+	for _, rev := range cmt.Reviewers {
+		t.add(rev, func(c *Contribution) { c.Reviewed++ })
+	}
+	for _, so := range cmt.SignedOffBy {
+		t.add(so, func(c *Contribution) { c.SignedOff++ })
+	}
+	for _, tb := range cmt.TestedBy {
+		t.add(tb, func(c *Contribution) { c.Tested++ })
+	}
+	for b, people := range cmt.Buckets {
+		for _, p := range people {
+			t.add(p, func(c *Contribution) {
+				if c.Buckets == nil {
+					c.Buckets = make(map[string]int)
+				}
+				c.Buckets[b]++
+			})
+		}
+	}
+}
+
+// LoadAliases reads a JSON file mapping canonical emails to lists of their
+// aliases, and returns the lowercased alias to canonical email mapping.
+func LoadAliases(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file map[string][]string
+	if err = json.Unmarshal(b, &file); err != nil {
+		return nil, err
+	}
+	aliases := make(map[string]string)
+	for canon, as := range file {
+		for _, a := range as {
+			aliases[strings.ToLower(a)] = strings.ToLower(canon)
+		}
+	}
+	return aliases, nil
+}
@@ -0,0 +1,172 @@
+package contrib
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScrapeMergesAliases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aliases.json")
+	writeTestFile(t, path, `{"jdoe@chromium.org": ["Jane.Doe@gmail.com", "jdoe@google.com"]}`)
+	aliases, err := LoadAliases(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := offlineRepo(t, linear(
+		testCommit{hash: "c3", author: "Jane Doe <jane.doe@gmail.com>", msg: "Personal\n"},
+		testCommit{hash: "c2", author: "John Roe <jroe@chromium.org>", msg: "Reviewed\n\nReviewed-by: Jane <jdoe@google.com>\n"},
+		testCommit{hash: "c1", author: "Jane Doe <jdoe@chromium.org>", msg: "Corporate\n"},
+	)...)
+	opts.Aliases = aliases
+
+	conts := scrape(t, opts)
+	if len(conts) != 2 {
+		t.Errorf("got %d contributors, want 2: %v", len(conts), conts)
+	}
+	c := conts["jdoe@chromium.org"]
+	if c.Created != 2 || c.Reviewed != 1 {
+		t.Errorf("Created = %v, Reviewed = %d, want 2, 1", c.Created, c.Reviewed)
+	}
+	if c.Name != "Jane Doe" {
+		t.Errorf("Name = %q, want the first one seen", c.Name)
+	}
+}
+
+func TestScrapeAuthorReviewingIsOneRow(t *testing.T) {
+	opts := offlineRepo(t, linear(
+		// the reviewer spelled the way Gerrit writes trailers, in another case
+		testCommit{hash: "c2", author: "John Roe <jroe@chromium.org>", msg: "Second\n\nReviewed-by: Jane Doe <JDoe@Chromium.org>\n"},
+		testCommit{hash: "c1", author: "Jane Doe <jdoe@chromium.org>", msg: "First\n\nReviewed-by: John Roe <jroe@chromium.org>\n"},
+	)...)
+
+	conts := scrape(t, opts)
+	if len(conts) != 2 {
+		t.Errorf("got %d contributors, want 2: %v", len(conts), conts)
+	}
+	for _, key := range []string{"jdoe@chromium.org", "jroe@chromium.org"} {
+		if c := conts[key]; c.Created != 1 || c.Reviewed != 1 {
+			t.Errorf("%s: Created = %v, Reviewed = %d, want 1, 1 on one row", key, c.Created, c.Reviewed)
+		}
+	}
+	out := writeTestOutput(t, conts, OutputOptions{Format: "csv", Sort: "name"})
+	if recs := readCSV(t, out, ','); len(recs) != 3 || recs[1][0] != "Jane Doe" || recs[2][0] != "John Roe" {
+		t.Errorf("wrote %q, want a row each", recs)
+	}
+}
+
+func TestScrapeExcludesBots(t *testing.T) {
+	luci := "Chromium LUCI CQ <chromium-scoped@luci-project-accounts.iam.gserviceaccount.com>"
+	opts := offlineRepo(t, linear(
+		testCommit{hash: "c3f0", author: "chromium-autoroll <chromium-autoroll@skia-public.iam.gserviceaccount.com>",
+			committer: luci, msg: "Roll Skia\n\nReviewed-by: Jane Doe <jdoe@chromium.org>\n"},
+		testCommit{hash: "c2f0", author: "John Roe <jroe@chromium.org>", committer: luci,
+			msg: "Fix it\n\nReviewed-by: Commit Bot <commit-bot@chromium.org>\nReviewed-by: Jane Doe <jdoe@chromium.org>\n"},
+		testCommit{hash: "c1f0", author: "Sheriff-Bot <sheriff-bot@chromium.org>", msg: "Disable a flaky test\n"},
+	)...)
+	opts.Bots = DefaultBots
+
+	conts := scrape(t, opts)
+	if got, want := authors(conts), "jroe@chromium.org"; got != want {
+		t.Errorf("counted authors %q, want %q", got, want)
+	}
+	if c := conts["jdoe@chromium.org"]; c.Reviewed != 2 {
+		t.Errorf("a human reviewing a bot: Reviewed = %d, want 2", c.Reviewed)
+	}
+	for k := range conts {
+		if k != "jroe@chromium.org" && k != "jdoe@chromium.org" {
+			t.Errorf("counted bot %s", k)
+		}
+	}
+
+	opts.Bots = nil
+	if got, want := authors(scrape(t, opts)), "chromium-autoroll@skia-public.iam.gserviceaccount.com jroe@chromium.org sheriff-bot@chromium.org"; got != want {
+		t.Errorf("counted %q without bots left out, want %q", got, want)
+	}
+}
+
+func TestScrapeCommitDates(t *testing.T) {
+	jane, john := "Jane Doe <jdoe@chromium.org>", "John Roe <jroe@chromium.org>"
+	opts := offlineRepo(t, linear(
+		// authored out of order with the history, in other zones
+		testCommit{hash: "c4f0", author: jane, date: "Tue Jun 15 18:00:00 2021 +0200", msg: "Fourth\n"},
+		testCommit{hash: "c3f0", author: jane, date: "Fri Dec 31 23:59:59 2021 -0800", msg: "Third\n"},
+		testCommit{hash: "c2f0", author: jane, date: "Mon Feb 01 08:00:00 2021 -0800",
+			msg: "Second\n\nReviewed-by: " + john + "\n"},
+		testCommit{hash: "c1f0", author: jane, date: "Sat Mar 06 10:00:00 2021 +0000", msg: "First\n"},
+	)...)
+	conts := scrape(t, opts)
+
+	c := conts["jdoe@chromium.org"]
+	first := time.Date(2021, time.February, 1, 16, 0, 0, 0, time.UTC)
+	last := time.Date(2022, time.January, 1, 7, 59, 59, 0, time.UTC)
+	if !c.FirstCommit.Equal(first) || !c.LastCommit.Equal(last) {
+		t.Errorf("commit dates = %v, %v, want %v, %v", c.FirstCommit, c.LastCommit, first, last)
+	}
+	if r := conts["jroe@chromium.org"]; !r.FirstCommit.IsZero() || !r.LastCommit.IsZero() {
+		t.Errorf("reviewer who authored nothing has commit dates %v, %v", r.FirstCommit, r.LastCommit)
+	}
+
+	// a single commit sets both
+	one := scrape(t, offlineRepo(t, testCommit{hash: "c1f0", author: john, date: "Sat Mar 06 10:00:00 2021 +0000",
+		msg: "First\n"}))["jroe@chromium.org"]
+	if want := time.Date(2021, time.March, 6, 10, 0, 0, 0, time.UTC); !one.FirstCommit.Equal(want) ||
+		!one.LastCommit.Equal(want) {
+		t.Errorf("commit dates of one commit = %v, %v, want both %v", one.FirstCommit, one.LastCommit, want)
+	}
+
+	recs := readCSV(t, writeTestOutput(t, conts, OutputOptions{Format: "csv", Sort: "name"}), ',')
+	col := make(map[string]int)
+	for i, h := range recs[0] {
+		col[h] = i
+	}
+	if got := recs[1][col["first_commit"]] + " " + recs[1][col["last_commit"]]; got != "2021-02-01T08:00:00-08:00 2021-12-31T23:59:59-08:00" {
+		t.Errorf("commit dates of %s written as %s", recs[1][0], got)
+	}
+	if got := recs[2][col["first_commit"]] + recs[2][col["last_commit"]]; got != "" {
+		t.Errorf("commit dates of %s written as %q, want none", recs[2][0], got)
+	}
+}
+
+// selfReviewed is a history where Jane reviews her own commit, once under
+// another spelling of her email, along with John.
+func selfReviewed() []testCommit {
+	return linear(
+		testCommit{hash: "c2f0", author: "Jane Doe <jdoe@chromium.org>",
+			msg: "Land my own change\n\nReviewed-by: Jane <JDoe@chromium.org>\nReviewed-by: John Roe <jroe@chromium.org>\n"},
+		testCommit{hash: "c1f0", author: "Jane Doe <jdoe@chromium.org>",
+			msg: "First\n\nReviewed-by: Jane Doe <jdoe@chromium.org>\n"},
+	)
+}
+
+func TestScrapeSelfReviews(t *testing.T) {
+	for _, tc := range []struct {
+		noSelfReview  bool
+		jane, john    int
+		commitReviews string
+	}{
+		// counted like any other review by default
+		{false, 2, 1, "Jane <JDoe@chromium.org>, John Roe <jroe@chromium.org>"},
+		{true, 0, 1, "John Roe <jroe@chromium.org>"},
+	} {
+		opts := offlineRepo(t, selfReviewed()...)
+		opts.NoSelfReview = tc.noSelfReview
+		var reviewers []string
+		opts.Commit = func(cmt CommitRecord) {
+			if cmt.Hash == "c2f0" {
+				reviewers = cmt.Reviewers
+			}
+		}
+		conts := scrape(t, opts)
+		jane, john := conts["jdoe@chromium.org"], conts["jroe@chromium.org"]
+		if jane.Created != 2 || jane.Reviewed != tc.jane || john.Reviewed != tc.john {
+			t.Errorf("NoSelfReview %v: jane created %v reviewed %d, john reviewed %d, want 2, %d, %d",
+				tc.noSelfReview, jane.Created, jane.Reviewed, john.Reviewed, tc.jane, tc.john)
+		}
+		if got := strings.Join(reviewers, ", "); got != tc.commitReviews {
+			t.Errorf("NoSelfReview %v: reviewers of c2f0 = %s, want %s", tc.noSelfReview, got, tc.commitReviews)
+		}
+	}
+}
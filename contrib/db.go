@@ -0,0 +1,176 @@
+package contrib
+
+import (
+	"database/sql"
+	"time"
+
+	// registers the pure go "sqlite" driver
+	_ "modernc.org/sqlite"
+)
+
+// dbSchema is created in databases WriteDB writes to, if missing.
+const dbSchema = `
+CREATE TABLE IF NOT EXISTS contributors (
+	key          TEXT PRIMARY KEY,
+	name         TEXT NOT NULL,
+	email        TEXT NOT NULL,
+	created      REAL NOT NULL,
+	reviewed     INTEGER NOT NULL,
+	committed    INTEGER NOT NULL,
+	signed_off   INTEGER NOT NULL,
+	tested       INTEGER NOT NULL,
+	co_authored  INTEGER NOT NULL,
+	insertions   INTEGER NOT NULL,
+	deletions    INTEGER NOT NULL,
+	first_commit TEXT,
+	last_commit  TEXT
+);
+CREATE TABLE IF NOT EXISTS buckets (
+	key    TEXT NOT NULL REFERENCES contributors(key),
+	bucket TEXT NOT NULL,
+	count  INTEGER NOT NULL,
+	PRIMARY KEY (key, bucket)
+);
+CREATE TABLE IF NOT EXISTS commits (
+	hash       TEXT PRIMARY KEY,
+	author     TEXT NOT NULL,
+	committer  TEXT NOT NULL,
+	date       TEXT NOT NULL,
+	change_id  TEXT NOT NULL,
+	revert     INTEGER NOT NULL,
+	reland     INTEGER NOT NULL,
+	message    TEXT NOT NULL,
+	insertions INTEGER NOT NULL,
+	deletions  INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS reviews (
+	hash     TEXT NOT NULL REFERENCES commits(hash),
+	reviewer TEXT NOT NULL,
+	PRIMARY KEY (hash, reviewer)
+);
+`
+
+// WriteDB writes conts and the commits they were counted from to the sqlite
+// database at path, created if missing. Commits and their reviews already in
+// it are replaced, so runs over overlapping histories don't repeat them, and
+// so are the counts of contributors, which are those of the latest run that
+// saw them.
+func WriteDB(path string, conts map[string]Contribution, cmts []CommitRecord) error {
+	db, err := OpenDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = writeContributions(tx, conts); err != nil {
+		return err
+	}
+	for _, cmt := range cmts {
+		if err = writeCommitRow(tx, cmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DB is a database written to the way WriteDB does, but a commit at a time
+// as they're counted, so they needn't be held until the end of the run.
+type DB struct {
+	db *sql.DB
+}
+
+// OpenDB opens the sqlite database at path, creating it if missing.
+func OpenDB(path string) (*DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(dbSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DB{db: db}, nil
+}
+
+// WriteCommit writes cmt and its reviews.
+func (d *DB) WriteCommit(cmt CommitRecord) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = writeCommitRow(tx, cmt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// WriteContributions writes the counts of conts.
+func (d *DB) WriteContributions(conts map[string]Contribution) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = writeContributions(tx, conts); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close closes the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+func writeContributions(tx *sql.Tx, conts map[string]Contribution) error {
+	for k, c := range conts {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO contributors VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			k, c.Name, c.Email, c.Created, c.Reviewed, c.Committed, c.SignedOff, c.Tested, c.CoAuthored,
+			c.Insertions, c.Deletions, dbDate(c.FirstCommit), dbDate(c.LastCommit))
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`DELETE FROM buckets WHERE key = ?`, k); err != nil {
+			return err
+		}
+		for b, n := range c.Buckets {
+			if _, err = tx.Exec(`INSERT INTO buckets VALUES (?, ?, ?)`, k, b, n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeCommitRow(tx *sql.Tx, cmt CommitRecord) error {
+	_, err := tx.Exec(`INSERT OR REPLACE INTO commits VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		cmt.Hash, cmt.Author, cmt.Committer, dbDate(cmt.Date), cmt.ChangeID, cmt.Revert, cmt.Reland, cmt.Message,
+		cmt.Insertions, cmt.Deletions)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM reviews WHERE hash = ?`, cmt.Hash); err != nil {
+		return err
+	}
+	for _, r := range cmt.Reviewers {
+		if _, err = tx.Exec(`INSERT OR IGNORE INTO reviews VALUES (?, ?)`, cmt.Hash, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbDate stores t as RFC3339 text, or NULL if it's zero.
+func dbDate(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,124 @@
+package contrib
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// queryInt runs q on the database at path, returning the number it selects.
+func queryInt(t *testing.T, path, q string, args ...any) int {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err = db.QueryRow(q, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", q, err)
+	}
+	return n
+}
+
+func TestWriteDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contributions.db")
+	conts := testConts()
+	jane := conts["jdoe@chromium.org"]
+	jane.FirstCommit = time.Date(2021, time.March, 1, 9, 30, 0, 0, time.UTC)
+	jane.LastCommit = jane.FirstCommit
+	jane.Buckets = map[string]int{"acked": 2}
+	conts["jdoe@chromium.org"] = jane
+	cmts := []CommitRecord{
+		{Hash: "c2f0", Author: "Jane Doe <jdoe@chromium.org>", Committer: "Jane Doe <jdoe@chromium.org>",
+			Date: jane.FirstCommit, ChangeID: "I0123", Message: "Second\n", Insertions: 10, Deletions: 2,
+			Reviewers: []string{"John Roe <jroe@chromium.org>", "John Roe <jroe@chromium.org>"}},
+		{Hash: "c1f0", Author: "John Roe <jroe@chromium.org>", Committer: "John Roe <jroe@chromium.org>",
+			Date: jane.FirstCommit, Revert: true, Message: "Revert \"First\"\n"},
+	}
+	if err := WriteDB(path, conts, cmts); err != nil {
+		t.Fatalf("WriteDB: %v", err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		name        string
+		created     float64
+		reviewed    int
+		first, last sql.NullString
+	)
+	err = db.QueryRow(`SELECT name, created, reviewed, first_commit, last_commit FROM contributors WHERE key = ?`,
+		"jdoe@chromium.org").Scan(&name, &created, &reviewed, &first, &last)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Jane Doe" || created != 3 || reviewed != 1 || first.String != "2021-03-01T09:30:00Z" ||
+		last.String != first.String {
+		t.Errorf("row of jdoe = %q %v %d %v %v", name, created, reviewed, first, last)
+	}
+	if n := queryInt(t, path, `SELECT count(*) FROM contributors WHERE key = ? AND first_commit IS NULL`,
+		"jroe@chromium.org"); n != 1 {
+		t.Error("first_commit of a contributor who authored nothing isn't NULL")
+	}
+	if n := queryInt(t, path, `SELECT count FROM buckets WHERE key = ? AND bucket = 'acked'`, "jdoe@chromium.org"); n != 2 {
+		t.Errorf("acked bucket = %d, want 2", n)
+	}
+	if n := queryInt(t, path, `SELECT insertions FROM commits WHERE hash = 'c2f0'`); n != 10 {
+		t.Errorf("insertions of c2f0 = %d, want 10", n)
+	}
+	if n := queryInt(t, path, `SELECT revert FROM commits WHERE hash = 'c1f0'`); n != 1 {
+		t.Error("c1f0 isn't stored as a revert")
+	}
+	if n := queryInt(t, path, `SELECT count(*) FROM reviews WHERE hash = 'c2f0'`); n != 1 {
+		t.Errorf("got %d reviews of c2f0, want the repeated reviewer once", n)
+	}
+
+	// a rerun replaces the rows instead of repeating them
+	jane.Created = 5
+	jane.Buckets = nil
+	conts["jdoe@chromium.org"] = jane
+	cmts[0].Reviewers = nil
+	if err := WriteDB(path, conts, cmts[:1]); err != nil {
+		t.Fatalf("WriteDB again: %v", err)
+	}
+	for q, want := range map[string]int{
+		`SELECT count(*) FROM contributors`:                                2,
+		`SELECT created FROM contributors WHERE key = 'jdoe@chromium.org'`: 5,
+		`SELECT count(*) FROM buckets`:                                     0,
+		`SELECT count(*) FROM commits`:                                     2,
+		`SELECT count(*) FROM reviews`:                                     0,
+	} {
+		if n := queryInt(t, path, q); n != want {
+			t.Errorf("%s = %d after a rerun, want %d", q, n, want)
+		}
+	}
+}
+
+func TestDBWritesCommitsAsTheyCome(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contributions.db")
+	db, err := OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.WriteCommit(CommitRecord{Hash: "c1f0", Author: "Jane Doe <jdoe@chromium.org>",
+		Date: time.Date(2021, time.March, 1, 9, 30, 0, 0, time.UTC), Reviewers: []string{"John Roe <jroe@chromium.org>"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// readable before the contributions are written
+	if n := queryInt(t, path, `SELECT count(*) FROM reviews WHERE reviewer = ?`, "John Roe <jroe@chromium.org>"); n != 1 {
+		t.Errorf("got %d reviews, want 1", n)
+	}
+	if err = db.WriteContributions(testConts()); err != nil {
+		t.Fatal(err)
+	}
+	if n := queryInt(t, path, `SELECT reviewed FROM contributors WHERE key = 'jroe@chromium.org'`); n != 4 {
+		t.Errorf("reviewed of jroe = %d, want 4", n)
+	}
+}
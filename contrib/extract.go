@@ -0,0 +1,432 @@
+package contrib
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// resolveLink resolves href, as found on a page of repurl, to an absolute url.
+// Gitiles links are relative to the host serving the page, so resolving them
+// against repurl keeps the walk on mirrors and other instances than
+// chromium.googlesource.com.
+func resolveLink(repurl, href string) (string, error) {
+	base, err := url.Parse(repurl)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// fullHash matches a whole, not abbreviated, commit hash.
+var fullHash = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// tagPrefix starts the refs of tags given as branches.
+const tagPrefix = "refs/tags/"
+
+// IsBranchName reports whether branch names a branch, rather than a tag or a
+// commit hash to start from.
+func IsBranchName(branch string) bool {
+	return !fullHash.MatchString(branch) && !strings.HasPrefix(branch, tagPrefix)
+}
+
+// commitLink returns the url of the gitiles page of the commit hash.
+func commitLink(repurl, hash string) (string, error) {
+	return url.JoinPath(repurl, "+", hash)
+}
+
+func getMainLink(doc *html.Node, repurl, branch string) (string, error) {
+	n := findNode(doc, func(n *html.Node) bool {
+		return isElement(n, "a") && strings.Contains(getAttr(n, "href"), "/"+branch)
+	})
+	if n == nil {
+		return "", fmt.Errorf("can't find link!")
+	}
+	return resolveLink(repurl, getAttr(n, "href"))
+}
+
+func getCommitHash(doc *html.Node) (string, error) {
+	n := findText(doc, "commit")
+	if n == nil {
+		return "", fmt.Errorf("can't find commit!")
+	}
+	h, ok := cellText(n, 1)
+	if !ok {
+		return "", fmt.Errorf("can't find commit hash!")
+	}
+	return strings.TrimSpace(h), nil
+}
+
+// getAuthor returns the author as "Name <email>", or as the bare name for
+// commits imported without an email.
+func getAuthor(doc *html.Node) (string, error) {
+	n := findText(doc, "author")
+	if n == nil {
+		return "", fmt.Errorf("can't find author!")
+	}
+	s, ok := cellText(n, 1)
+	if !ok {
+		return "", fmt.Errorf("can't find author!")
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// cellText returns the text starting the cell skip cells after the one
+// holding the label n, and false if the page isn't laid out like that.
+func cellText(n *html.Node, skip int) (string, bool) {
+	c := cell(n, skip)
+	if c == nil || c.FirstChild == nil {
+		return "", false
+	}
+	return c.FirstChild.Data, true
+}
+
+// cellLinkText is like cellText for cells holding a link.
+func cellLinkText(n *html.Node, skip int) (string, bool) {
+	c := cell(n, skip)
+	if c == nil || c.FirstChild == nil || c.FirstChild.FirstChild == nil {
+		return "", false
+	}
+	return c.FirstChild.FirstChild.Data, true
+}
+
+func cell(n *html.Node, skip int) *html.Node {
+	c := n.Parent
+	for i := 0; c != nil && i < skip; i++ {
+		c = c.NextSibling
+	}
+	return c
+}
+
+var authorDateLayouts = []string{
+	"Mon Jan _2 15:04:05 2006 -0700",
+	"Mon Jan _2 15:04:05 2006",
+}
+
+func getAuthorDate(doc *html.Node) (time.Time, error) {
+	n := findText(doc, "author")
+	if n == nil {
+		return time.Time{}, fmt.Errorf("can't find author date!")
+	}
+	s, ok := cellText(n, 2)
+	if !ok {
+		return time.Time{}, fmt.Errorf("can't find author date!")
+	}
+	s = strings.TrimSpace(s)
+	for _, layout := range authorDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can't parse author date %q", s)
+}
+
+func getCommitter(doc *html.Node) (string, error) {
+	n := findText(doc, "committer")
+	if n == nil {
+		return "", fmt.Errorf("can't find committer!")
+	}
+	s, ok := cellText(n, 1)
+	if !ok {
+		return "", fmt.Errorf("can't find committer!")
+	}
+	return strings.TrimSpace(s), nil
+}
+
+func getCommitMessage(doc *html.Node) (string, error) {
+	n := findNode(doc, func(n *html.Node) bool {
+		return isElement(n, "pre") && findNode(n, func(n *html.Node) bool { return n.Type == html.TextNode }) != nil
+	})
+	if n == nil {
+		return "", fmt.Errorf("can't find commit!")
+	}
+	return textContent(n), nil
+}
+
+// getParentCommitLink returns "" for a root commit, which has no parent row.
+// A page cut short before the message that follows the rows isn't taken for
+// one.
+func getParentCommitLink(doc *html.Node, repurl string) (string, error) {
+	if findText(doc, "commit") == nil {
+		return "", fmt.Errorf("can't find commit!")
+	}
+	n := findText(doc, "parent")
+	if n == nil {
+		if _, err := getCommitMessage(doc); err != nil {
+			return "", err
+		}
+		return "", nil
+	}
+	h, ok := cellLinkText(n, 1)
+	if !ok {
+		return "", fmt.Errorf("can't find parent hash!")
+	}
+	return commitLink(repurl, strings.TrimSpace(h))
+}
+
+// getTagObjectLink returns the url of the page of the object an annotated
+// tag's page names.
+func getTagObjectLink(doc *html.Node, repurl string) (string, error) {
+	if findText(doc, "tag") == nil {
+		return "", fmt.Errorf("can't find tag!")
+	}
+	n := findText(doc, "object")
+	if n == nil {
+		return "", fmt.Errorf("can't find tag object!")
+	}
+	h, ok := cellLinkText(n, 1)
+	if !ok {
+		return "", fmt.Errorf("can't find tag object hash!")
+	}
+	return commitLink(repurl, strings.TrimSpace(h))
+}
+
+// getParents returns the hashes of all the parents, none for a root commit.
+func getParents(doc *html.Node) ([]string, error) {
+	parents := make([]string, 0)
+	for _, n := range findAll(doc, func(n *html.Node) bool { return n.Type == html.TextNode && n.Data == "parent" }) {
+		h, ok := cellLinkText(n, 1)
+		if !ok {
+			return nil, fmt.Errorf("can't find parent hash!")
+		}
+		parents = append(parents, strings.TrimSpace(h))
+	}
+	return parents, nil
+}
+
+// diffstatCounts matches the counts of a diffstat summary and the words
+// following them.
+var diffstatCounts = regexp.MustCompile(`(\d[\d,]*) ([a-z]+)`)
+
+// parseDiffstat reads the counts before the added and removed words in a
+// diffstat summary, like "3 files changed, 12 insertions(+), 1 deletion(-)".
+// A count missing from s is zero.
+func parseDiffstat(s, added, removed string) (ins, del int) {
+	for _, m := range diffstatCounts.FindAllStringSubmatch(s, -1) {
+		n, err := strconv.Atoi(strings.ReplaceAll(m[1], ",", ""))
+		if err != nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(m[2], added):
+			ins = n
+		case strings.HasPrefix(m[2], removed):
+			del = n
+		}
+	}
+	return ins, del
+}
+
+// reviewer is a reviewer read from a trailer, and the line of the message,
+// counted from 1, it was read from.
+type reviewer struct {
+	Name string
+	Line int
+}
+
+func getReviewerLines(msg string) []reviewer {
+	trailers := getTrailerLines(msg, "Reviewed-by: ")
+	reviewers := make([]reviewer, 0, len(trailers))
+	for _, t := range trailers {
+		reviewers = append(reviewers, reviewer{Name: t.value, Line: t.line})
+	}
+	return reviewers
+}
+
+func getReviewers(msg string) ([]string, error) {
+	names := make([]string, 0)
+	for _, r := range getReviewerLines(msg) {
+		slog.Debug("read reviewer", "reviewer", r.Name, "line", r.Line)
+		names = append(names, r.Name)
+	}
+	return names, nil
+}
+
+func getSignedOffBy(msg string) ([]string, error) {
+	return getTrailers(msg, "Signed-off-by: "), nil
+}
+
+func getTestedBy(msg string) ([]string, error) {
+	return getTrailers(msg, "Tested-by:"), nil
+}
+
+func getCoAuthors(msg string) ([]string, error) {
+	return getTrailers(msg, "Co-authored-by:"), nil
+}
+
+// getBugs returns the bugs referenced by Bug: and BUG= lines, which may list
+// several separated by commas or spaces. Bugs of the chromium tracker are
+// keyed by their bare number, others keep their tracker prefix, like b/123.
+func getBugs(msg string) []string {
+	bugs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, v := range append(getTrailers(msg, "Bug:"), getTrailers(msg, "BUG=")...) {
+		for _, b := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			b = strings.TrimPrefix(b, "chromium:")
+			if strings.EqualFold(b, "none") || seen[b] {
+				continue
+			}
+			seen[b] = true
+			bugs = append(bugs, b)
+		}
+	}
+	return bugs
+}
+
+// getChangeID returns the gerrit Change-Id of the commit, the last one if it
+// was squashed from several, or "" if it has none.
+func getChangeID(msg string) string {
+	ids := getTrailers(msg, "Change-Id:")
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[len(ids)-1]
+}
+
+// getSubject returns the first paragraph of msg, its lines trimmed and
+// joined by spaces, like git does for the subject of a message without a
+// blank line after its first line.
+func getSubject(msg string) string {
+	var lines []string
+	for _, line := range strings.Split(msg, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if len(lines) > 0 {
+				break
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, " ")
+}
+
+// isRevert and isReland classify a commit by the start of its subject, the
+// way git revert and the chromium reland convention word it.
+func isRevert(msg string) bool {
+	return strings.HasPrefix(strings.TrimSpace(msg), "Revert")
+}
+
+func isReland(msg string) bool {
+	return strings.HasPrefix(strings.TrimSpace(msg), "Reland")
+}
+
+// getListTrailers returns the distinct values of the lines starting with any
+// of keys, each line listing any number of them separated by commas, like
+// R=jdoe@chromium.org,jroe@chromium.org.
+func getListTrailers(msg string, keys []string) []string {
+	vals := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		for _, line := range getTrailers(msg, k) {
+			for _, v := range strings.Split(line, ",") {
+				if v = strings.TrimSpace(v); v != "" && !seen[v] {
+					seen[v] = true
+					vals = append(vals, v)
+				}
+			}
+		}
+	}
+	return vals
+}
+
+// getBuckets returns who the trailers of each key of buckets name, by the
+// bucket it's mapped to. Someone named by several keys of a bucket is in it
+// once.
+func getBuckets(msg string, buckets map[string]string) map[string][]string {
+	keys := make([]string, 0, len(buckets))
+	for k := range buckets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	named := make(map[string][]string)
+	for _, k := range keys {
+		if vals := getTrailers(msg, k); len(vals) > 0 {
+			b := buckets[k]
+			named[b] = appendNew(named[b], vals)
+		}
+	}
+	return named
+}
+
+// messageTrailers are the keys of the trailers stripTrailers removes besides
+// the ReviewerKeys: those counted or read, and those gerrit and chromium's
+// tooling add.
+var messageTrailers = []string{
+	"Reviewed-by:", "Signed-off-by:", "Tested-by:", "Co-authored-by:",
+	"Bug:", "BUG=", "Change-Id:", "Reviewed-on:", "Commit-Queue:", "Auto-Submit:",
+	"Cr-Commit-Position:", "Cr-Branched-From:",
+}
+
+// stripTrailers returns msg without the lines starting with any of keys, the
+// way getTrailers matches them, nor the blank lines left ending it.
+func stripTrailers(msg string, keys []string) string {
+	kept := make([]string, 0)
+	for _, line := range strings.Split(msg, "\n") {
+		if !isTrailerLine(line, keys) {
+			kept = append(kept, line)
+		}
+	}
+	s := strings.TrimRight(strings.Join(kept, "\n"), " \t\n")
+	if s != "" && strings.HasSuffix(msg, "\n") {
+		s += "\n"
+	}
+	return s
+}
+
+func isTrailerLine(line string, keys []string) bool {
+	line = strings.TrimLeft(line, " \t")
+	for _, k := range keys {
+		if len(line) >= len(k) && strings.EqualFold(line[:len(k)], k) {
+			return true
+		}
+	}
+	return false
+}
+
+// getTrailers returns the distinct values of the lines starting with prefix,
+// in any case, in the order they first appear. Lines may be indented, the way
+// pages sometimes render messages, and surrounding whitespace is trimmed off
+// values.
+func getTrailers(msg, prefix string) []string {
+	trailers := getTrailerLines(msg, prefix)
+	vals := make([]string, 0, len(trailers))
+	for _, t := range trailers {
+		vals = append(vals, t.value)
+	}
+	return vals
+}
+
+// trailer is a value getTrailerLines read, and its line counted from 1.
+type trailer struct {
+	value string
+	line  int
+}
+
+// getTrailerLines is getTrailers also telling where each value was read.
+func getTrailerLines(msg, prefix string) []trailer {
+	lines := strings.Split(msg, "\n")
+	trailers := make([]trailer, 0)
+	seen := make(map[string]bool)
+	for i, line := range lines {
+		line = strings.TrimLeft(line, " \t")
+		if len(line) >= len(prefix) && strings.EqualFold(line[:len(prefix)], prefix) {
+			if v := strings.TrimSpace(line[len(prefix):]); v != "" && !seen[v] {
+				seen[v] = true
+				trailers = append(trailers, trailer{value: v, line: i + 1})
+			}
+		}
+	}
+	return trailers
+}
@@ -0,0 +1,496 @@
+package contrib
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// extractPages are pages made to exercise the extractors: a whole commit
+// page, one of a root commit, a row missing, a parent row without its link,
+// a page cut short after the author label, and a repository page.
+//
+//go:embed testdata/extract
+var extractPages embed.FS
+
+// extractPage parses the page name of extractPages.
+func extractPage(t testing.TB, name string) *html.Node {
+	t.Helper()
+	b, err := extractPages.ReadFile("testdata/extract/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseString(t, string(b))
+}
+
+func TestExtractors(t *testing.T) {
+	const hash = "b2f0c4e6a8d1f3b5c7e9a0d2f4b6c8e1a3d5f7b9"
+	msg := "tast: Fix the widget test on octopus\n\nBUG=b:178234561\nTEST=tast run $DUT widget.Basic\n\n" +
+		"Change-Id: I2b4d6f8a0c1e3a5b7d9f0b2d4e6a8c1e3f5b7d9a\nReviewed-by: John Roe <jroe@chromium.org>\n"
+	parentLink := func(doc *html.Node) (string, error) { return getParentCommitLink(doc, testRepo) }
+	mainLink := func(branch string) func(doc *html.Node) (string, error) {
+		return func(doc *html.Node) (string, error) { return getMainLink(doc, testRepo, branch) }
+	}
+
+	for _, tc := range []struct {
+		name    string
+		page    string
+		extract func(doc *html.Node) (string, error)
+		want    string
+		wantErr bool
+	}{
+		{"hash", "commit.html", getCommitHash, hash, false},
+		{"author", "commit.html", getAuthor, "Jane Doe <jdoe@chromium.org>", false},
+		{"message", "commit.html", getCommitMessage, msg, false},
+		{"parent", "commit.html", parentLink, testRepo + "/+/a1f0b3d5c7e9f1a3b5d7c9e1f3a5b7d9c1e3f5a7", false},
+		{"main", "repo.html", mainLink("main"), testRepo + "/+/refs/heads/main", false},
+		{"release branch", "repo.html", mainLink("release-R89-13729.B"), testRepo + "/+/refs/heads/release-R89-13729.B", false},
+
+		{"root parent", "root.html", parentLink, "", false},
+		{"root hash", "root.html", getCommitHash, hash, false},
+
+		{"missing author", "no-author.html", getAuthor, "", true},
+		{"missing author, hash", "no-author.html", getCommitHash, hash, false},
+		{"missing parent link", "no-parent-link.html", parentLink, "", true},
+		{"missing branch", "repo.html", mainLink("stable"), "", true},
+		{"not a repository page", "commit.html", mainLink("stable"), "", true},
+
+		{"truncated hash", "truncated.html", getCommitHash, hash, false},
+		{"truncated author", "truncated.html", getAuthor, "", true},
+		{"truncated message", "truncated.html", getCommitMessage, "", true},
+		// not a root commit, the rest never arrived
+		{"truncated parent", "truncated.html", parentLink, "", true},
+
+		{"not a commit page, hash", "repo.html", getCommitHash, "", true},
+		{"not a commit page, author", "repo.html", getAuthor, "", true},
+		{"not a commit page, message", "repo.html", getCommitMessage, "", true},
+		{"not a commit page, parent", "repo.html", parentLink, "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.extract(extractPage(t, tc.page))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetReviewersDeduplicates(t *testing.T) {
+	msg := "Fix it\n\nReviewed-by: John Roe <jroe@chromium.org>\nReviewed-by: Alex Poe <apoe@google.com>\n" +
+		"Reviewed-by: John Roe <jroe@chromium.org>\n"
+	got, err := getReviewers(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"John Roe <jroe@chromium.org>", "Alex Poe <apoe@google.com>"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getReviewers = %q, want %q", got, want)
+	}
+
+	opts := offlineRepo(t, testCommit{hash: "c1", author: "Jane Doe <jdoe@chromium.org>", msg: msg})
+	if c := scrape(t, opts)["jroe@chromium.org"]; c.Reviewed != 1 {
+		t.Errorf("Reviewed = %d, want 1", c.Reviewed)
+	}
+}
+
+// parseTestPage parses the saved page name of testdata/gitiles.
+func parseTestPage(t testing.TB, name string) *html.Node {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(readTestPage(t, name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestGetTestedBy(t *testing.T) {
+	msg, err := getCommitMessage(parseTestPage(t, "main.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := getTestedBy(msg)
+	if want := []string{"Jane Doe <jdoe@chromium.org>"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("getTestedBy of main.html = %q, want %q", got, want)
+	}
+
+	got, _ = getTestedBy("Fix it\n\nTested-by:John Roe <jroe@chromium.org>\nTested-by: \t Alex Poe <apoe@google.com>  \n")
+	if want := []string{"John Roe <jroe@chromium.org>", "Alex Poe <apoe@google.com>"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("getTestedBy = %q, want %q", got, want)
+	}
+}
+
+func TestEntityDecodedNames(t *testing.T) {
+	cmt, err := parseCommit(Gitiles, parseTestPage(t, "c3e5a7b9d1f2a4c6e8b0d2f4a6c8e0b2d4f6a8c9.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Sam O'Brien <sobrien@chromium.org>"}; !reflect.DeepEqual(cmt.CoAuthors, want) {
+		t.Errorf("CoAuthors = %q, want %q", cmt.CoAuthors, want)
+	}
+
+	doc := parseString(t, `<table><tr><th class="Metadata-title">author</th><td>Fran&ccedil;ois O&#39;Brien &amp; co &lt;fob@chromium.org&gt;</td></tr></table>`)
+	if got, err := getAuthor(doc); err != nil || got != "François O'Brien & co <fob@chromium.org>" {
+		t.Errorf("getAuthor = %q, %v", got, err)
+	}
+
+	opts := offlineRepo(t, testCommit{hash: "c1", author: "Sam O'Brien <sobrien@chromium.org>",
+		msg: "Fix it\n\nReviewed-by: François Roe <froe@chromium.org>\n"})
+	conts := scrape(t, opts)
+	if c := conts["sobrien@chromium.org"]; c.Name != "Sam O'Brien" {
+		t.Errorf("author name = %q", c.Name)
+	}
+	if c := conts["froe@chromium.org"]; c.Name != "François Roe" {
+		t.Errorf("reviewer name = %q", c.Name)
+	}
+}
+
+func TestGetBugs(t *testing.T) {
+	for _, tc := range []struct {
+		name, msg string
+		want      []string
+	}{
+		{"Bug:", "Fix it\n\nBug: 123456\n", []string{"123456"}},
+		{"BUG=", "Fix it\n\nBUG=chromium:123456\nTEST=none\n", []string{"123456"}},
+		{"both styles", "Fix it\n\nBUG=chromium:123456, b:178234561\nBug: 123456, 654321\n", []string{"123456", "654321", "b:178234561"}},
+		{"none", "Fix it\n\nBUG=None\n", []string{}},
+		{"no trailer", "Fix bug 123456\n", []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := getBugs(tc.msg); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("getBugs = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGetSubject(t *testing.T) {
+	for _, tc := range []struct {
+		name, msg, want string
+	}{
+		{"paragraphs", "tast: Fix the widget test\n\nIt timed out on octopus.\n\nThe wait is longer now.\n\n" +
+			"BUG=b:178234561\nReviewed-by: John Roe <jroe@chromium.org>\n", "tast: Fix the widget test"},
+		{"no blank line after the subject", "tast: Fix the widget\ntest on octopus\n\nBody.\n", "tast: Fix the widget test on octopus"},
+		{"blank lines first", "\n  \n  Fix it  \n", "Fix it"},
+		{"only a subject", "Fix it", "Fix it"},
+		{"empty", "\n\n", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := getSubject(tc.msg); got != tc.want {
+				t.Errorf("getSubject = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	// and it's in the record of each commit
+	opts := offlineRepo(t, testCommit{hash: "c1f0", author: "Jane Doe <jdoe@chromium.org>",
+		msg: "Add a widget\nand its test\n\nThe body.\n\nReviewed-by: John Roe <jroe@chromium.org>\n"})
+	var subject string
+	opts.Commit = func(cmt CommitRecord) { subject = cmt.Subject }
+	scrape(t, opts)
+	if subject != "Add a widget and its test" {
+		t.Errorf("Subject = %q", subject)
+	}
+}
+
+func TestChangeIDAndRevert(t *testing.T) {
+	for _, tc := range []struct {
+		page, changeID string
+		revert, reland bool
+	}{
+		{"main.html", "I0f2b4d6e8a1c3e5f7b9d0a2c4e6f8b1d3a5c7e9f", false, false},
+		{"8a2f4c6e1b3d5f7a9c0e2b4d6f8a1c3e5b7d9f0a.html", "I8c0e2a4f6b1d3e5a7c9f0b2d4e6a8c1f3b5d7e9a", true, false},
+		{"c3e5a7b9d1f2a4c6e8b0d2f4a6c8e0b2d4f6a8c9.html", "I3a5c7e9b1d2f4a6c8e0b2d4f6a8c1e3b5d7f9a0c", false, true},
+		// no Change-Id
+		{"e1f3a5c7b9d2e4f6a8c0b1d3e5f7a9c2e4b6d8f0.html", "", false, false},
+	} {
+		t.Run(tc.page, func(t *testing.T) {
+			cmt, err := parseCommit(Gitiles, parseTestPage(t, tc.page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cmt.ChangeID != tc.changeID || cmt.Revert != tc.revert || cmt.Reland != tc.reland {
+				t.Errorf("ChangeID, Revert, Reland = %q, %v, %v, want %q, %v, %v", cmt.ChangeID, cmt.Revert, cmt.Reland,
+					tc.changeID, tc.revert, tc.reland)
+			}
+			b, err := json.Marshal(cmt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var rec map[string]interface{}
+			json.Unmarshal(b, &rec)
+			if rec["change_id"] != tc.changeID || rec["revert"] != tc.revert || rec["reland"] != tc.reland {
+				t.Errorf("json record = %s", b)
+			}
+		})
+	}
+}
+
+func TestLinksWithTrailingSlash(t *testing.T) {
+	main, repo := parseTestPage(t, "main.html"), parseTestPage(t, "repo.html")
+	for _, repurl := range []string{testRepo, testRepo + "/"} {
+		t.Run(repurl, func(t *testing.T) {
+			for _, tc := range []struct {
+				name string
+				link func() (string, error)
+				want string
+			}{
+				{"commitLink", func() (string, error) { return commitLink(repurl, "8a2f") }, testRepo + "/+/8a2f"},
+				{"getParentCommitLink", func() (string, error) { return getParentCommitLink(main, repurl) },
+					testRepo + "/+/8a2f4c6e1b3d5f7a9c0e2b4d6f8a1c3e5b7d9f0a"},
+				{"getMainLink", func() (string, error) { return getMainLink(repo, repurl, "main") }, testRepo + "/+/refs/heads/main"},
+				{"RefLink", func() (string, error) { return gitiles{}.RefLink(repurl, "main") }, testRepo + "/+/refs/heads/main"},
+				{"resolveLink", func() (string, error) { return resolveLink(repurl, "/chromiumos/platform/tast-tests/+log/8a2f") },
+					testRepo + "/+log/8a2f"},
+			} {
+				if got, err := tc.link(); err != nil || got != tc.want {
+					t.Errorf("%s = %q, %v, want %q", tc.name, got, err, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLinksOnOtherHosts(t *testing.T) {
+	const mirror = "https://gitiles.example.org:8443/chromiumos/platform/tast-tests"
+	main, repo := parseTestPage(t, "main.html"), parseTestPage(t, "repo.html")
+	for _, tc := range []struct {
+		name string
+		link func() (string, error)
+		want string
+	}{
+		{"commitLink", func() (string, error) { return commitLink(mirror, "8a2f") }, mirror + "/+/8a2f"},
+		{"getParentCommitLink", func() (string, error) { return getParentCommitLink(main, mirror) },
+			mirror + "/+/8a2f4c6e1b3d5f7a9c0e2b4d6f8a1c3e5b7d9f0a"},
+		{"getMainLink", func() (string, error) { return getMainLink(repo, mirror, "main") }, mirror + "/+/refs/heads/main"},
+		{"RefLink", func() (string, error) { return gitiles{}.RefLink(mirror, "main") }, mirror + "/+/refs/heads/main"},
+		// links to other hosts are left on them
+		{"absolute", func() (string, error) { return resolveLink(mirror, testRepo+"/+/8a2f") }, testRepo + "/+/8a2f"},
+		{"scheme relative", func() (string, error) {
+			return resolveLink(mirror, "//chromium.googlesource.com/chromiumos/platform/tast-tests/+/8a2f")
+		}, testRepo + "/+/8a2f"},
+	} {
+		if got, err := tc.link(); err != nil || got != tc.want {
+			t.Errorf("%s = %q, %v, want %q", tc.name, got, err, tc.want)
+		}
+	}
+
+	// a whole walk stays on the mirror
+	f := newFakeDevTools(t)
+	cmts := fiveCommits()
+	f.pages[mirror+"/+/refs/heads/main"] = commitPage(cmts[0])
+	for _, c := range cmts {
+		f.pages[mirror+"/+/"+c.hash] = commitPage(c)
+	}
+	opts := f.options()
+	opts.RepoURL = mirror
+	if conts := scrape(t, opts); len(conts) != len(cmts) {
+		t.Errorf("got %d contributors, want %d", len(conts), len(cmts))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, u := range f.navigated {
+		if !strings.HasPrefix(u, mirror+"/") {
+			t.Errorf("navigated off the mirror to %s", u)
+		}
+	}
+}
+
+func TestGetAuthorWithoutEmail(t *testing.T) {
+	doc := parseTestPage(t, "e1f3a5c7b9d2e4f6a8c0b1d3e5f7a9c2e4b6d8f0.html")
+	if got, err := getAuthor(doc); err != nil || got != "Imported Author" {
+		t.Errorf("getAuthor = %q, %v, want the bare name", got, err)
+	}
+	if name, email := splitContributor("Imported Author"); name != "Imported Author" || email != "" {
+		t.Errorf("splitContributor = %q, %q", name, email)
+	}
+
+	for _, page := range []string{
+		`<table><tr><th>author</th></tr></table>`,
+		`<table><tr><th>author</th><td></td></tr></table>`,
+		`<p>author</p>`,
+		`author`,
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("getAuthor of %q panicked: %v", page, r)
+				}
+			}()
+			if got, err := getAuthor(parseString(t, page)); err == nil {
+				t.Errorf("getAuthor of %q = %q, want an error", page, got)
+			}
+		}()
+	}
+}
+
+func TestExtractorsDontPanic(t *testing.T) {
+	extractors := map[string]func(doc *html.Node) error{
+		"getCommitHash":       func(doc *html.Node) error { _, err := getCommitHash(doc); return err },
+		"getAuthor":           func(doc *html.Node) error { _, err := getAuthor(doc); return err },
+		"getAuthorDate":       func(doc *html.Node) error { _, err := getAuthorDate(doc); return err },
+		"getCommitter":        func(doc *html.Node) error { _, err := getCommitter(doc); return err },
+		"getCommitMessage":    func(doc *html.Node) error { _, err := getCommitMessage(doc); return err },
+		"getParentCommitLink": func(doc *html.Node) error { _, err := getParentCommitLink(doc, testRepo); return err },
+		"getParents":          func(doc *html.Node) error { _, err := getParents(doc); return err },
+		"getMainLink":         func(doc *html.Node) error { _, err := getMainLink(doc, testRepo, "main"); return err },
+	}
+	b, err := extractPages.ReadFile("testdata/extract/commit.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(b)
+
+	var pages []string
+	// cut short anywhere
+	for i := 0; i < len(page); i += 7 {
+		pages = append(pages, page[:i])
+	}
+	// and altered: labels out of their rows, cells emptied or turned into
+	// something else
+	for _, r := range []*strings.Replacer{
+		strings.NewReplacer("<td>", "<td></td><td>"),
+		strings.NewReplacer("<td>", "", "</td>", ""),
+		strings.NewReplacer("<th", "<span", "</th>", "</span>"),
+		strings.NewReplacer("<a ", "<b ", "</a>", "</b>"),
+		strings.NewReplacer("<tr>", "", "</tr>", ""),
+		strings.NewReplacer("<table>", "", "</table>", ""),
+		strings.NewReplacer(`class="Metadata-title">`, `class="Metadata-title"></th><th>`),
+	} {
+		pages = append(pages, r.Replace(page))
+	}
+
+	for i, p := range pages {
+		doc := parseString(t, p)
+		for name, extract := range extractors {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("%s of page %d panicked: %v\n%s", name, i, r, p)
+					}
+				}()
+				extract(doc)
+			}()
+		}
+	}
+	if t.Failed() {
+		return
+	}
+
+	// the whole page still parses, the first altered one doesn't
+	for name, extract := range extractors {
+		if err := extract(extractPage(t, "commit.html")); err != nil && name != "getMainLink" {
+			t.Errorf("%s of the whole page: %v", name, err)
+		}
+	}
+	if _, err := parseCommit(Gitiles, parseString(t, pages[len(pages)-7])); err == nil {
+		t.Error("parseCommit of a page with its cells shifted succeeded")
+	}
+}
+
+func TestGetReviewersIndented(t *testing.T) {
+	msg := "Fix it\n\n  Reviewed-by: John Roe <jroe@chromium.org>\n\tReviewed-by: Alex Poe <apoe@google.com>\n" +
+		"See the Reviewed-by: Sam Roe <sroe@chromium.org> line of the reland.\n"
+	got, err := getReviewers(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"John Roe <jroe@chromium.org>", "Alex Poe <apoe@google.com>"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("getReviewers = %q, want %q", got, want)
+	}
+}
+
+func TestGetReviewerLines(t *testing.T) {
+	msg := "Add a widget\n" +
+		"\n" +
+		"The widget does things.\n" +
+		"\n" +
+		"Bug: 1234\n" +
+		"Reviewed-by: John Roe <jroe@chromium.org>\n" +
+		"Commit-Queue: Jane Doe <jdoe@chromium.org>\n" +
+		"  Reviewed-by: Alex Poe <apoe@google.com>\n" +
+		"Reviewed-by: John Roe <jroe@chromium.org>\n" +
+		"Reviewed-by: Sam Roe <sroe@chromium.org>"
+	want := []reviewer{
+		{"John Roe <jroe@chromium.org>", 6},
+		{"Alex Poe <apoe@google.com>", 8},
+		// the repeated John is kept at his first line
+		{"Sam Roe <sroe@chromium.org>", 10},
+	}
+	if got := getReviewerLines(msg); !reflect.DeepEqual(got, want) {
+		t.Errorf("getReviewerLines = %+v, want %+v", got, want)
+	}
+
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(prev)
+	names, err := getReviewers(msg)
+	if err != nil || len(names) != 3 || names[1] != "Alex Poe <apoe@google.com>" {
+		t.Errorf("getReviewers = %q, %v", names, err)
+	}
+	if !strings.Contains(logs.String(), `reviewer="Alex Poe <apoe@google.com>" line=8`) {
+		t.Errorf("the debug log doesn't tell the line of a reviewer:\n%s", logs.String())
+	}
+}
+
+func TestReviewerTrailerVariants(t *testing.T) {
+	for _, key := range []string{"Reviewed-by:", "Reviewed-By:", "reviewed-by:", "REVIEWED-BY:"} {
+		got, err := getReviewers("Fix it\n\n" + key + " John Roe <jroe@chromium.org>\n")
+		if want := []string{"John Roe <jroe@chromium.org>"}; err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: getReviewers = %q, %v, want %q", key, got, err, want)
+		}
+	}
+
+	msg := "Fix it\n\nR=jroe@chromium.org, apoe@google.com\nr=sroe@chromium.org\nTBR=tbr@chromium.org\n"
+	if got, _ := getReviewers(msg); len(got) != 0 {
+		t.Errorf("R= counted without being configured: %q", got)
+	}
+	if got, want := getListTrailers(msg, []string{"R="}), []string{"jroe@chromium.org", "apoe@google.com", "sroe@chromium.org"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("getListTrailers(R=) = %q, want %q", got, want)
+	}
+
+	opts := offlineRepo(t, testCommit{hash: "c1", author: "Jane Doe <jdoe@chromium.org>",
+		msg: "Fix it\n\nR=jroe@chromium.org\nReviewed-By: Alex Poe <apoe@google.com>\n"})
+	if got := scrape(t, opts); got["jroe@chromium.org"].Reviewed != 0 || got["apoe@google.com"].Reviewed != 1 {
+		t.Errorf("default keys counted %v", got)
+	}
+	opts.ReviewerKeys = []string{"R="}
+	if got := scrape(t, opts); got["jroe@chromium.org"].Reviewed != 1 || got["apoe@google.com"].Reviewed != 1 {
+		t.Errorf("with R= counted %v", got)
+	}
+}
+
+func TestDiffstat(t *testing.T) {
+	doc := parseString(t, readTestPage(t, "main.html"))
+	if ins, del := Gitiles.(diffstatSource).Diffstat(doc); ins != 1204 || del != 7 {
+		t.Errorf("Diffstat of main.html = %d, %d, want 1204, 7", ins, del)
+	}
+	// an empty merge shows none
+	if ins, del := Gitiles.(diffstatSource).Diffstat(extractPage(t, "root.html")); ins != 0 || del != 0 {
+		t.Errorf("Diffstat of a page without one = %d, %d, want 0, 0", ins, del)
+	}
+
+	for _, tc := range []struct {
+		s        string
+		ins, del int
+	}{
+		{"1 file changed, 1 insertion(+), 1 deletion(-)", 1, 1},
+		{"3 files changed, 12,345 insertions(+)", 12345, 0},
+		{"2 files changed, 40 deletions(-)", 0, 40},
+		{"1 file changed", 0, 0},
+		{"", 0, 0},
+	} {
+		if ins, del := parseDiffstat(tc.s, "insertion", "deletion"); ins != tc.ins || del != tc.del {
+			t.Errorf("parseDiffstat(%q) = %d, %d, want %d, %d", tc.s, ins, del, tc.ins, tc.del)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package contrib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isGzipPath reports whether the file at path is gzipped, by its .gz suffix.
+func isGzipPath(path string) bool {
+	return strings.HasSuffix(path, ".gz")
+}
+
+// writeOutputFile is writeFile gzipping data if path ends in .gz.
+func writeOutputFile(path string, data []byte) error {
+	if isGzipPath(path) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	return writeFile(path, data, 0644)
+}
+
+// readOutputFile reads the file at path, gunzipping it if path ends in .gz.
+func readOutputFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil || !isGzipPath(path) {
+		return b, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// writeFile writes data to the file at path like ioutil.WriteFile, but
+// through a temporary file renamed over path once complete, so path never
+// holds a partial write.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Chmod(tmp, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
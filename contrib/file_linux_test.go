@@ -0,0 +1,69 @@
+//go:build linux
+
+package contrib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// limitFileSize has writes past n bytes into a file fail, rather than kill
+// the process, until the returned func is called.
+func limitFileSize(t *testing.T, n uint64) func() {
+	var old syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_FSIZE, &old); err != nil {
+		t.Fatal(err)
+	}
+	signal.Ignore(syscall.SIGXFSZ)
+	if err := syscall.Setrlimit(syscall.RLIMIT_FSIZE, &syscall.Rlimit{Cur: n, Max: old.Max}); err != nil {
+		t.Skipf("can't limit file sizes: %v", err)
+	}
+	return func() {
+		if err := syscall.Setrlimit(syscall.RLIMIT_FSIZE, &old); err != nil {
+			t.Fatal(err)
+		}
+		signal.Reset(syscall.SIGXFSZ)
+	}
+}
+
+func TestWriteOutputFailingPartway(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.csv")
+	const prev = "name,email,created\nJane Doe,jdoe@chromium.org,3\n"
+	writeTestFile(t, path, prev)
+
+	conts := make(map[string]Contribution)
+	for i := 0; i < 1000; i++ {
+		email := fmt.Sprintf("dev%d@chromium.org", i)
+		conts[email] = Contribution{Name: fmt.Sprint("Dev ", i), Email: email, Created: 1}
+	}
+	restore := limitFileSize(t, 4096)
+	err := WriteOutput(conts, path, OutputOptions{Format: "csv"})
+	restore()
+	if err == nil {
+		t.Fatal("WriteOutput past the file size limit succeeded")
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != prev {
+		t.Errorf("the output holds %d bytes of the failed write, want it untouched", len(b))
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		t.Errorf("left %q behind, want only out.csv", names)
+	}
+}
@@ -0,0 +1,230 @@
+package contrib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// gerritPageSize is how many changes are asked for in each query.
+const gerritPageSize = 100
+
+// gerritXSSIPrefix is prepended by Gerrit to every JSON response.
+const gerritXSSIPrefix = ")]}'"
+
+const gerritDateLayout = "2006-01-02 15:04:05.000000000"
+
+type gerritAccount struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type gerritPerson struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Date  string `json:"date"`
+}
+
+type gerritChange struct {
+	CurrentRevision string `json:"current_revision"`
+	Revisions       map[string]struct {
+		Commit struct {
+			Parents []struct {
+				Commit string `json:"commit"`
+			} `json:"parents"`
+			Author    gerritPerson `json:"author"`
+			Committer gerritPerson `json:"committer"`
+			Message   string       `json:"message"`
+		} `json:"commit"`
+		Files map[string]struct{} `json:"files"`
+	} `json:"revisions"`
+	Labels map[string]struct {
+		All []struct {
+			gerritAccount
+			Value int `json:"value"`
+		} `json:"all"`
+	} `json:"labels"`
+	Insertions  int  `json:"insertions"`
+	Deletions   int  `json:"deletions"`
+	MoreChanges bool `json:"_more_changes"`
+}
+
+// gerritCommits queries the merged changes of a branch from the REST api of
+// Gerrit, most recently updated first, which is close to but not exactly the
+// order of history.
+type gerritCommits struct {
+	ctx     context.Context
+	client  *http.Client
+	query   string
+	cookies map[string]string
+	headers map[string]string
+	start   int
+	changes []gerritChange
+	more    bool
+}
+
+func newGerritCommits(ctx context.Context, opts Options) (*gerritCommits, error) {
+	u, err := url.Parse(opts.RepoURL)
+	if err != nil {
+		return nil, err
+	}
+	project := strings.Trim(u.Path, "/")
+	if project == "" {
+		return nil, fmt.Errorf("can't find project in %q!", opts.RepoURL)
+	}
+
+	base := strings.TrimSuffix(opts.GerritURL, "/")
+	if base == "" {
+		// chromium.googlesource.com is reviewed at chromium-review.googlesource.com
+		labels := strings.SplitN(u.Host, ".", 2)
+		if len(labels) != 2 {
+			return nil, fmt.Errorf("can't derive gerrit host from %q!", u.Host)
+		}
+		base = u.Scheme + "://" + labels[0] + "-review." + labels[1]
+	}
+
+	q := url.Values{}
+	q.Set("q", fmt.Sprintf("project:%s branch:%s status:merged", project, opts.Branch))
+	q.Set("n", fmt.Sprint(gerritPageSize))
+	for _, o := range []string{"CURRENT_REVISION", "CURRENT_COMMIT", "CURRENT_FILES", "DETAILED_ACCOUNTS", "DETAILED_LABELS"} {
+		q.Add("o", o)
+	}
+	return &gerritCommits{
+		ctx:     ctx,
+		client:  http.DefaultClient,
+		query:   base + "/changes/?" + q.Encode(),
+		cookies: opts.Cookies,
+		headers: opts.Headers,
+		more:    true,
+	}, nil
+}
+
+func (g *gerritCommits) next() (CommitRecord, error) {
+	if len(g.changes) == 0 {
+		if !g.more {
+			return CommitRecord{}, io.EOF
+		}
+		if err := g.fetch(); err != nil {
+			return CommitRecord{}, err
+		}
+		if len(g.changes) == 0 {
+			return CommitRecord{}, io.EOF
+		}
+	}
+
+	ch := g.changes[0]
+	g.changes = g.changes[1:]
+	cmt, err := ch.record()
+	if err != nil {
+		return cmt, &parseError{hash: cmt.Hash, err: err}
+	}
+	return cmt, nil
+}
+
+// fetch gets the next page of changes.
+func (g *gerritCommits) fetch() error {
+	req, err := http.NewRequestWithContext(g.ctx, "GET", fmt.Sprintf("%s&S=%d", g.query, g.start), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range g.headers {
+		req.Header.Set(k, v)
+	}
+	for name, value := range g.cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gerrit query failed with %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	changes, err := parseGerritChanges(b)
+	if err != nil {
+		return err
+	}
+	g.changes = changes
+	g.start += len(changes)
+	g.more = len(changes) > 0 && changes[len(changes)-1].MoreChanges
+	return nil
+}
+
+// parseGerritChanges decodes a response of the changes query.
+func parseGerritChanges(b []byte) ([]gerritChange, error) {
+	s := strings.TrimPrefix(strings.TrimLeft(string(b), " \r\n"), gerritXSSIPrefix)
+	var changes []gerritChange
+	if err := json.Unmarshal([]byte(s), &changes); err != nil {
+		return nil, fmt.Errorf("can't decode gerrit changes: %v", err)
+	}
+	return changes, nil
+}
+
+// record converts the current revision of the change. Reviewers are read
+// from the message trailers like on the other backends, falling back to the
+// positive Code-Review votes when there are none.
+func (ch gerritChange) record() (CommitRecord, error) {
+	rec := CommitRecord{Hash: ch.CurrentRevision}
+	rev, ok := ch.Revisions[ch.CurrentRevision]
+	if !ok {
+		return rec, fmt.Errorf("can't find current revision!")
+	}
+	c := rev.Commit
+
+	date, err := time.ParseInLocation(gerritDateLayout, c.Author.Date, time.UTC)
+	if err != nil {
+		return rec, fmt.Errorf("can't parse author date %q", c.Author.Date)
+	}
+	rec.Date = date
+	rec.Message = c.Message
+	rec.Insertions, rec.Deletions = ch.Insertions, ch.Deletions
+	rec.Files = make([]string, 0, len(rev.Files))
+	for f := range rev.Files {
+		// the message is listed as a file of its own
+		if f != "/COMMIT_MSG" {
+			rec.Files = append(rec.Files, f)
+		}
+	}
+	sort.Strings(rec.Files)
+	rec.Author = gerritAccount{c.Author.Name, c.Author.Email}.String()
+	rec.Committer = gerritAccount{c.Committer.Name, c.Committer.Email}.String()
+	rec.Parents = make([]string, 0, len(c.Parents))
+	for _, p := range c.Parents {
+		rec.Parents = append(rec.Parents, p.Commit)
+	}
+
+	if rec.Reviewers, err = getReviewers(rec.Message); err != nil {
+		return rec, err
+	}
+	if len(rec.Reviewers) == 0 {
+		for _, v := range ch.Labels["Code-Review"].All {
+			if v.Value > 0 {
+				rec.Reviewers = append(rec.Reviewers, v.gerritAccount.String())
+			}
+		}
+	}
+	return rec, readMessage(&rec)
+}
+
+// String formats the account the way commit pages show people.
+func (a gerritAccount) String() string {
+	if a.Email == "" {
+		return a.Name
+	}
+	return a.Name + " <" + a.Email + ">"
+}
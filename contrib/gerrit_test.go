@@ -0,0 +1,154 @@
+package contrib
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// readGerritChanges reads the saved response of the changes query.
+func readGerritChanges(t testing.TB) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("..", "testdata", "gerrit", "changes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseGerritChanges(t *testing.T) {
+	changes, err := parseGerritChanges(readGerritChanges(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2", len(changes))
+	}
+	if changes[0].MoreChanges || !changes[1].MoreChanges {
+		t.Errorf("_more_changes = %v, %v, want false, true", changes[0].MoreChanges, changes[1].MoreChanges)
+	}
+
+	if _, err = parseGerritChanges([]byte(`[{"current_revision": "5d1e"}]`)); err != nil {
+		t.Errorf("without the XSSI prefix: %v", err)
+	}
+	if _, err = parseGerritChanges([]byte(gerritXSSIPrefix + "\n<html>Not Found</html>")); err == nil {
+		t.Error("parseGerritChanges of html succeeded")
+	}
+}
+
+func TestGerritChangeRecord(t *testing.T) {
+	changes, err := parseGerritChanges(readGerritChanges(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := changes[0].record()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"Hash", rec.Hash, "5d1e7c0a9f3b42e6a8c1d0f7b2e9a4c6d3f8b1e0"},
+		{"Author", rec.Author, "John Roe <jroe@chromium.org>"},
+		{"Committer", rec.Committer, "Chromeos LUCI <chromeos-scoped@luci-project-accounts.iam.gserviceaccount.com>"},
+		{"Parents", rec.Parents, []string{"8a2f4c6e1b3d5f7a9c0e2b4d6f8a1c3e5b7d9f0a"}},
+		{"Reviewers", rec.Reviewers, []string{"Jane Doe <jdoe@chromium.org>"}},
+		{"TestedBy", rec.TestedBy, []string{"John Roe <jroe@chromium.org>"}},
+		{"Bugs", rec.Bugs, []string{"b:178234561"}},
+		{"ChangeID", rec.ChangeID, "I5d1e7c0a9f3b42e6a8c1d0f7b2e9a4c6d3f8b1e0"},
+		{"Subject", rec.Subject, "tast: Add a retry to the widget test"},
+		{"Insertions", rec.Insertions, 42},
+		{"Deletions", rec.Deletions, 3},
+		{"Files", rec.Files, []string{"src/example/widget.go", "src/example/widget_test.go"}},
+	} {
+		if !reflect.DeepEqual(f.got, f.want) {
+			t.Errorf("%s = %#v, want %#v", f.name, f.got, f.want)
+		}
+	}
+	if want := time.Date(2021, 3, 1, 17, 30, 0, 0, time.UTC); !rec.Date.Equal(want) {
+		t.Errorf("Date = %v, want %v", rec.Date, want)
+	}
+
+	// no Reviewed-by trailers, the positive Code-Review votes stand in
+	rec, err = changes[1].record()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Jane Doe <jdoe@chromium.org>"}; !reflect.DeepEqual(rec.Reviewers, want) {
+		t.Errorf("Reviewers from votes = %q, want %q", rec.Reviewers, want)
+	}
+	if !rec.Revert {
+		t.Error("revert not told")
+	}
+}
+
+func TestGerritChangeRecordErrors(t *testing.T) {
+	changes, err := parseGerritChanges(readGerritChanges(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := changes[0]
+	ch.CurrentRevision = "0000"
+	if _, err = ch.record(); err == nil {
+		t.Error("record without the current revision succeeded")
+	}
+
+	changes, _ = parseGerritChanges(readGerritChanges(t))
+	ch = changes[0]
+	rev := ch.Revisions[ch.CurrentRevision]
+	rev.Commit.Author.Date = "Mar 1 2021"
+	ch.Revisions[ch.CurrentRevision] = rev
+	if _, err = ch.record(); err == nil {
+		t.Error("record with a bad date succeeded")
+	}
+}
+
+func TestScrapeGerrit(t *testing.T) {
+	changes := readGerritChanges(t)
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("S"))
+		if c, err := r.Cookie("SID"); err != nil || c.Value != "s3cr3t" || r.Header.Get("Authorization") != "Basic dXNlcjpwYXNz" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("S") == "0" {
+			w.Write(changes)
+			return
+		}
+		fmt.Fprint(w, gerritXSSIPrefix+"\n[]")
+	}))
+	defer srv.Close()
+
+	conts, err := Scrape(context.Background(), Options{Backend: "gerrit", GerritURL: srv.URL, RepoURL: testRepo,
+		Branch: "main", Count: 100, Cookies: map[string]string{"SID": "s3cr3t"},
+		Headers: map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := authors(conts), "apoe@google.com jroe@chromium.org"; got != want {
+		t.Errorf("counted %q, want %q", got, want)
+	}
+	if c := conts["jdoe@chromium.org"]; c.Reviewed != 2 {
+		t.Errorf("Reviewed = %d, want 2", c.Reviewed)
+	}
+	if want := []string{"0", "2"}; !reflect.DeepEqual(queries, want) {
+		t.Errorf("queried from %q, want %q", queries, want)
+	}
+}
+
+func TestScrapeGerritRejectsSince(t *testing.T) {
+	_, err := Scrape(context.Background(), Options{Backend: "gerrit", RepoURL: testRepo, Branch: "main",
+		Since: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)})
+	if err == nil {
+		t.Error("Scrape with a since date on the gerrit backend succeeded")
+	}
+}
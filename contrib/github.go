@@ -0,0 +1,136 @@
+package contrib
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// github reads the commit pages of github.com, which name authors by their
+// account rather than by email.
+type github struct{}
+
+func (github) MainLink(doc *html.Node, repurl, branch string) (string, error) {
+	// github resolves a branch name in place of a commit hash
+	return url.JoinPath(repurl, "commit", branch)
+}
+
+func (github) CommitHash(doc *html.Node) (string, error) {
+	n := findNode(doc, func(n *html.Node) bool {
+		return isElement(n, "span") && hasClass(n, "sha") && n.FirstChild != nil
+	})
+	if n == nil {
+		return "", fmt.Errorf("can't find commit!")
+	}
+	return strings.TrimSpace(textContent(n)), nil
+}
+
+// githubAuthors returns the names in the commit-author elements, the author
+// first and the committer, if it's someone else, second.
+func githubAuthors(doc *html.Node) []string {
+	var names []string
+	for _, n := range findAll(doc, func(n *html.Node) bool { return hasClass(n, "commit-author") }) {
+		names = append(names, strings.TrimSpace(textContent(n)))
+	}
+	return names
+}
+
+func (github) Author(doc *html.Node) (string, error) {
+	names := githubAuthors(doc)
+	if len(names) == 0 {
+		return "", fmt.Errorf("can't find author!")
+	}
+	return names[0], nil
+}
+
+func (github) AuthorDate(doc *html.Node) (time.Time, error) {
+	n := findNode(doc, func(n *html.Node) bool { return isElement(n, "relative-time") })
+	if n == nil {
+		return time.Time{}, fmt.Errorf("can't find author date!")
+	}
+	s := getAttr(n, "datetime")
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("can't parse author date %q", s)
+	}
+	return t, nil
+}
+
+func (github) Committer(doc *html.Node) (string, error) {
+	names := githubAuthors(doc)
+	if len(names) == 0 {
+		return "", fmt.Errorf("can't find committer!")
+	}
+	return names[len(names)-1], nil
+}
+
+func (github) Message(doc *html.Node) (string, error) {
+	title := findNode(doc, func(n *html.Node) bool { return hasClass(n, "commit-title") })
+	if title == nil {
+		return "", fmt.Errorf("can't find commit!")
+	}
+	msg := strings.TrimSpace(textContent(title))
+	if desc := findNode(doc, func(n *html.Node) bool { return hasClass(n, "commit-desc") }); desc != nil {
+		msg += "\n\n" + strings.TrimSpace(textContent(desc))
+	}
+	return msg + "\n", nil
+}
+
+func (github) CommitLink(repurl, hash string) (string, error) {
+	return url.JoinPath(repurl, "commit", hash)
+}
+
+func (github) ParentLink(doc *html.Node, repurl string) (string, error) {
+	n := findNode(doc, func(n *html.Node) bool {
+		return isElement(n, "a") && getAttr(n, "data-hotkey") == "p"
+	})
+	if n == nil {
+		if _, err := (github{}).CommitHash(doc); err != nil {
+			return "", err
+		}
+		// a root commit
+		return "", nil
+	}
+	return resolveLink(repurl, getAttr(n, "href"))
+}
+
+func (github) Parents(doc *html.Node) ([]string, error) {
+	parents := make([]string, 0)
+	block := findNode(doc, func(n *html.Node) bool {
+		return hasClass(n, "sha-block") && strings.Contains(textContent(n), "parent")
+	})
+	if block == nil {
+		return parents, nil
+	}
+	for _, a := range findAll(block, func(n *html.Node) bool { return isElement(n, "a") && hasClass(n, "sha") }) {
+		href := getAttr(a, "href")
+		parents = append(parents, href[strings.LastIndex(href, "/")+1:])
+	}
+	return parents, nil
+}
+
+func (github) Reviewers(msg string) ([]string, error) { return getReviewers(msg) }
+
+func (github) Diffstat(doc *html.Node) (int, int) {
+	n := findNode(doc, func(n *html.Node) bool { return hasClass(n, "toc-diff-stats") })
+	if n == nil {
+		return 0, 0
+	}
+	// "Showing 2 changed files with 10 additions and 3 deletions."
+	return parseDiffstat(textContent(n), "addition", "deletion")
+}
+
+func (github) Files(doc *html.Node) []string {
+	headers := findAll(doc, func(n *html.Node) bool { return hasClass(n, "file-header") && getAttr(n, "data-path") != "" })
+	if len(headers) == 0 {
+		return nil
+	}
+	files := make([]string, 0, len(headers))
+	for _, h := range headers {
+		files = append(files, getAttr(h, "data-path"))
+	}
+	return files
+}
@@ -0,0 +1,134 @@
+package contrib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const githubTestRepo = "https://github.com/octo-org/widgets"
+
+// readGitHubPage parses the saved page name of testdata/github.
+func readGitHubPage(t testing.TB, name string) *html.Node {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("..", "testdata", "github", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseString(t, string(b))
+}
+
+func TestGitHub(t *testing.T) {
+	doc := readGitHubPage(t, "commit.html")
+
+	if got, err := GitHub.CommitHash(doc); err != nil || got != "3f1c9a7e5b2d4f6a8c0e1b3d5f7a9c2e4b6d8f01" {
+		t.Errorf("CommitHash = %q, %v", got, err)
+	}
+	if got, err := GitHub.Author(doc); err != nil || got != "octocat" {
+		t.Errorf("Author = %q, %v", got, err)
+	}
+	if got, err := GitHub.Committer(doc); err != nil || got != "web-flow" {
+		t.Errorf("Committer = %q, %v", got, err)
+	}
+	if got, err := GitHub.AuthorDate(doc); err != nil || !got.Equal(time.Date(2021, 3, 1, 17, 30, 0, 0, time.UTC)) {
+		t.Errorf("AuthorDate = %v, %v", got, err)
+	}
+
+	msg, err := GitHub.Message(doc)
+	if err != nil {
+		t.Fatalf("Message: %v", err)
+	}
+	if !strings.HasPrefix(msg, "Add a retry to the fetcher\n\nPages sometimes fail") || !strings.HasSuffix(msg, "<jroe@example.com>\n") {
+		t.Errorf("Message = %q", msg)
+	}
+	reviewers, err := GitHub.Reviewers(msg)
+	if want := []string{"Jane Doe <jdoe@example.com>", "John Roe <jroe@example.com>"}; err != nil || !reflect.DeepEqual(reviewers, want) {
+		t.Errorf("Reviewers = %q, %v, want %q", reviewers, err, want)
+	}
+
+	if got, err := GitHub.ParentLink(doc, githubTestRepo); err != nil ||
+		got != githubTestRepo+"/commit/9b8e7d6c5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d" {
+		t.Errorf("ParentLink = %q, %v", got, err)
+	}
+	parents, err := GitHub.Parents(doc)
+	if want := []string{"9b8e7d6c5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d", "1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b"}; err != nil || !reflect.DeepEqual(parents, want) {
+		t.Errorf("Parents = %q, %v, want %q", parents, err, want)
+	}
+
+	if got, err := GitHub.MainLink(doc, githubTestRepo, "main"); err != nil || got != githubTestRepo+"/commit/main" {
+		t.Errorf("MainLink = %q, %v", got, err)
+	}
+	if got, err := GitHub.CommitLink(githubTestRepo, "1a2b"); err != nil || got != githubTestRepo+"/commit/1a2b" {
+		t.Errorf("CommitLink = %q, %v", got, err)
+	}
+
+	if ins, del := GitHub.(diffstatSource).Diffstat(doc); ins != 1204 || del != 7 {
+		t.Errorf("Diffstat = %d, %d, want 1204, 7", ins, del)
+	}
+	if got, want := GitHub.(filesSource).Files(doc), []string{"fetch/fetch.go", "fetch/retry_test.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Files = %q, want %q", got, want)
+	}
+}
+
+func TestGitHubRootCommit(t *testing.T) {
+	doc := parseString(t, `<html><body><span class="sha-block">commit <span class="sha">a0b2c4d6</span></span></body></html>`)
+	if got, err := GitHub.ParentLink(doc, githubTestRepo); err != nil || got != "" {
+		t.Errorf("ParentLink = %q, %v, want none", got, err)
+	}
+	if got, err := GitHub.Parents(doc); err != nil || len(got) != 0 {
+		t.Errorf("Parents = %q, %v, want none", got, err)
+	}
+}
+
+func TestGitHubNotACommit(t *testing.T) {
+	doc := parseString(t, `<html><body><p>Not Found</p></body></html>`)
+	if _, err := GitHub.CommitHash(doc); err == nil {
+		t.Error("CommitHash succeeded")
+	}
+	if _, err := GitHub.Author(doc); err == nil {
+		t.Error("Author succeeded")
+	}
+	if _, err := GitHub.Committer(doc); err == nil {
+		t.Error("Committer succeeded")
+	}
+	if _, err := GitHub.AuthorDate(doc); err == nil {
+		t.Error("AuthorDate succeeded")
+	}
+	if _, err := GitHub.Message(doc); err == nil {
+		t.Error("Message succeeded")
+	}
+	if _, err := GitHub.ParentLink(doc, githubTestRepo); err == nil {
+		t.Error("ParentLink succeeded")
+	}
+	if ins, del := GitHub.(diffstatSource).Diffstat(doc); ins != 0 || del != 0 {
+		t.Errorf("Diffstat = %d, %d, want 0, 0", ins, del)
+	}
+	if files := GitHub.(filesSource).Files(doc); files != nil {
+		t.Errorf("Files = %q, want nil", files)
+	}
+}
+
+func TestSourceFor(t *testing.T) {
+	for _, tc := range []struct {
+		name, repurl string
+		want         Source
+	}{
+		{"", githubTestRepo, GitHub},
+		{"", "https://www.github.com/octo-org/widgets", GitHub},
+		{"", testRepo, Gitiles},
+		{"gitiles", githubTestRepo, Gitiles},
+		{"github", testRepo, GitHub},
+	} {
+		if got, err := SourceFor(tc.name, tc.repurl); err != nil || got != tc.want {
+			t.Errorf("SourceFor(%q, %q) = %T, %v, want %T", tc.name, tc.repurl, got, err, tc.want)
+		}
+	}
+	if _, err := SourceFor("gitlab", testRepo); err == nil {
+		t.Error("SourceFor(gitlab) succeeded")
+	}
+}
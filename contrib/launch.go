@@ -0,0 +1,93 @@
+package contrib
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/mafredri/cdp/devtool"
+)
+
+var chromeCandidates = []string{
+	"google-chrome",
+	"google-chrome-stable",
+	"chromium",
+	"chromium-browser",
+	"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+	"/Applications/Chromium.app/Contents/MacOS/Chromium",
+	`C:\Program Files\Google\Chrome\Application\chrome.exe`,
+	`C:\Program Files (x86)\Google\Chrome\Application\chrome.exe`,
+}
+
+func findChrome() (string, error) {
+	if p := os.Getenv("CHROME_PATH"); p != "" {
+		if _, err := os.Stat(p); err != nil {
+			return "", fmt.Errorf("CHROME_PATH=%q: %v", p, err)
+		}
+		return p, nil
+	}
+	for _, c := range chromeCandidates {
+		if p, err := exec.LookPath(c); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("can't find chrome or chromium, install one or set CHROME_PATH to its binary")
+}
+
+// launchChrome starts a headless browser listening on the port of the given
+// devtools endpoint and waits until the endpoint answers. The returned function
+// kills the browser and removes its temporary profile.
+func launchChrome(ctx context.Context, devtools string) (func(), error) {
+	bin, err := findChrome()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(devtools)
+	if err != nil {
+		return nil, err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "9222"
+	}
+
+	profile, err := ioutil.TempDir("", "gsoc-chromium-starter")
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(bin,
+		"--headless",
+		"--disable-gpu",
+		"--no-first-run",
+		"--remote-debugging-port="+port,
+		"--user-data-dir="+profile,
+	)
+	if err = cmd.Start(); err != nil {
+		os.RemoveAll(profile)
+		return nil, err
+	}
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(profile)
+	}
+
+	devt := devtool.New(devtools)
+	for {
+		if _, err = devt.Version(ctx); err == nil {
+			return stop, nil
+		}
+		select {
+		case <-ctx.Done():
+			stop()
+			return nil, fmt.Errorf("chrome didn't expose devtools on %s: %v", devtools, ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
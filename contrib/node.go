@@ -0,0 +1,95 @@
+package contrib
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// findNode returns the first node under root, root included, in depth-first
+// order that satisfies pred, or nil if there's none.
+func findNode(root *html.Node, pred func(*html.Node) bool) *html.Node {
+	if pred(root) {
+		return root
+	}
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if n := findNode(c, pred); n != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+// findAll returns all nodes under root, root included, that satisfy pred in
+// depth-first order.
+func findAll(root *html.Node, pred func(*html.Node) bool) []*html.Node {
+	var ns []*html.Node
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if pred(n) {
+			ns = append(ns, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(root)
+	return ns
+}
+
+// findText returns the first text node under root whose data is exactly s.
+func findText(root *html.Node, s string) *html.Node {
+	return findNode(root, func(n *html.Node) bool {
+		return n.Type == html.TextNode && n.Data == s
+	})
+}
+
+func isElement(n *html.Node, tag string) bool {
+	return n.Type == html.ElementNode && n.Data == tag
+}
+
+// textContent concatenates the text nodes under n.
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	for _, t := range findAll(n, func(n *html.Node) bool { return n.Type == html.TextNode }) {
+		sb.WriteString(t.Data)
+	}
+	return sb.String()
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, atr := range n.Attr {
+		if atr.Key == key {
+			return atr.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(getAttr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// snippetLen is how much of a page snippet shows.
+const snippetLen = 200
+
+// snippet returns the start of the html of the body under n, or of n itself
+// if it has none, with runs of whitespace collapsed, for error reports.
+func snippet(n *html.Node) string {
+	if body := findNode(n, func(n *html.Node) bool { return isElement(n, "body") }); body != nil {
+		n = body
+	}
+	var buf bytes.Buffer
+	html.Render(&buf, n)
+	s := strings.Join(strings.Fields(buf.String()), " ")
+	if r := []rune(s); len(r) > snippetLen {
+		s = string(r[:snippetLen]) + "..."
+	}
+	return s
+}
@@ -0,0 +1,75 @@
+package contrib
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const nodeTestPage = `<html><body><div id="a"><p>one</p><span>two</span></div><p>three</p></body></html>`
+
+func parseString(t testing.TB, s string) *html.Node {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestFindNode(t *testing.T) {
+	doc := parseString(t, nodeTestPage)
+	for _, tc := range []struct {
+		name string
+		pred func(*html.Node) bool
+		want string
+	}{
+		{"element", func(n *html.Node) bool { return isElement(n, "span") }, "two"},
+		{"first in order", func(n *html.Node) bool { return isElement(n, "p") }, "one"},
+		{"by attribute", func(n *html.Node) bool { return getAttr(n, "id") == "a" }, "onetwo"},
+		{"text", func(n *html.Node) bool { return n.Type == html.TextNode && n.Data == "three" }, "three"},
+		{"not found", func(n *html.Node) bool { return isElement(n, "table") }, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			n := findNode(doc, tc.pred)
+			if tc.want == "" {
+				if n != nil {
+					t.Errorf("found %v, want none", n)
+				}
+				return
+			}
+			if n == nil {
+				t.Fatal("found none")
+			}
+			if got := textContent(n); got != tc.want {
+				t.Errorf("found %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	root := findNode(doc, func(n *html.Node) bool { return true })
+	if root != doc {
+		t.Error("findNode doesn't start at the root")
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	doc := parseString(t, nodeTestPage)
+	var got []string
+	for _, n := range findAll(doc, func(n *html.Node) bool { return isElement(n, "p") }) {
+		got = append(got, textContent(n))
+	}
+	if strings.Join(got, " ") != "one three" {
+		t.Errorf("found %q, want one and three in order", got)
+	}
+	if texts := findAll(doc, func(n *html.Node) bool { return n.Type == html.TextNode }); len(texts) != 3 {
+		t.Errorf("found %d text nodes, want 3", len(texts))
+	}
+	if ns := findAll(doc, func(n *html.Node) bool { return isElement(n, "table") }); ns != nil {
+		t.Errorf("found %v, want nil", ns)
+	}
+	if findText(doc, "two") == nil || findText(doc, "tw") != nil {
+		t.Error("findText doesn't match whole text nodes only")
+	}
+}
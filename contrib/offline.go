@@ -0,0 +1,71 @@
+package contrib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// manifestFile, if present in a directory of saved pages, maps urls to the
+// files under it holding their pages.
+const manifestFile = "manifest.json"
+
+// errNoSavedPage is the error of a url whose page wasn't saved.
+var errNoSavedPage = errors.New("can't find saved page")
+
+// dirPages returns a pageFunc reading saved pages from dir instead of
+// navigating to them. The page of a url is the file manifest.json maps it to,
+// else <hash>.html for a commit url ending in its hash, else the file a
+// cache of the pages would store it in, so a CacheDir can be read back as is.
+func dirPages(dir string) (pageFunc, error) {
+	manifest := make(map[string]string)
+	b, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+	if err == nil {
+		if err = json.Unmarshal(b, &manifest); err != nil {
+			return nil, fmt.Errorf("can't read %s: %v", manifestFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return func(url string) (string, error) {
+		var candidates []string
+		if f, ok := manifest[url]; ok {
+			candidates = append(candidates, f)
+		}
+		candidates = append(candidates, path.Base(url)+".html")
+		sum := sha256.Sum256([]byte(url))
+		candidates = append(candidates, hex.EncodeToString(sum[:])+".html")
+
+		for _, f := range candidates {
+			b, err := ioutil.ReadFile(filepath.Join(dir, f))
+			if err == nil {
+				return string(b), nil
+			}
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+		return "", fmt.Errorf("%w of %s!", errNoSavedPage, url)
+	}, nil
+}
+
+// offlineCommits returns the commits of the history opts selects from start
+// on, read from the pages saved in opts.HTMLDir.
+func offlineCommits(opts Options, start string) (commitIter, error) {
+	pages, err := dirPages(opts.HTMLDir)
+	if err != nil {
+		return nil, err
+	}
+	walker, src, err := newWalker(opts, parsed(pages), start)
+	if err != nil {
+		return nil, err
+	}
+	return &pageCommits{walker: walker, src: src}, nil
+}
@@ -0,0 +1,210 @@
+package contrib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// savedRepo returns the options scraping the saved pages of testdata/gitiles.
+func savedRepo() Options {
+	return Options{HTMLDir: filepath.Join("..", "testdata", "gitiles"), RepoURL: testRepo, Branch: "main", Source: Gitiles,
+		Count: 100}
+}
+
+func TestScrapeSavedPages(t *testing.T) {
+	opts := savedRepo()
+	var hashes []string
+	opts.Commit = func(cmt CommitRecord) { hashes = append(hashes, cmt.Hash[:4]) }
+	conts := scrape(t, opts)
+
+	// the walk follows first parents down to the root
+	if got, want := strings.Join(hashes, " "), "5d1e 8a2f c3e5 e1f3 f7a9 a0b2"; got != want {
+		t.Errorf("counted commits %q, want %q", got, want)
+	}
+	for _, tc := range []struct {
+		key                          string
+		created                      float64
+		reviewed, committed, coAuthd int
+	}{
+		{"jdoe@chromium.org", 2, 1, 1, 0},
+		{"jroe@chromium.org", 2, 2, 1, 0},
+		{"apoe@google.com", 1, 2, 0, 0},
+		{"sobrien@chromium.org", 0, 0, 0, 1},
+		{"chromeos-scoped@luci-project-accounts.iam.gserviceaccount.com", 0, 0, 4, 0},
+		// people named without an email are keyed by name
+		{"Imported Author", 1, 0, 0, 0},
+		{"Jane Doe", 0, 1, 0, 0},
+	} {
+		c, ok := conts[tc.key]
+		if !ok {
+			t.Errorf("no contribution of %s", tc.key)
+			continue
+		}
+		if c.Created != tc.created || c.Reviewed != tc.reviewed || c.Committed != tc.committed || c.CoAuthored != tc.coAuthd {
+			t.Errorf("%s: Created, Reviewed, Committed, CoAuthored = %v, %d, %d, %d, want %v, %d, %d, %d", tc.key,
+				c.Created, c.Reviewed, c.Committed, c.CoAuthored, tc.created, tc.reviewed, tc.committed, tc.coAuthd)
+		}
+	}
+	if len(conts) != 7 {
+		t.Errorf("got %d contributors, want 7", len(conts))
+	}
+}
+
+func TestScrapeSavedStartingPoints(t *testing.T) {
+	for _, tc := range []struct {
+		branch, want string
+		isBranch     bool
+	}{
+		{"main", "5d1e 8a2f c3e5 e1f3 f7a9 a0b2", true},
+		{"refs/heads/main", "5d1e 8a2f c3e5 e1f3 f7a9 a0b2", true},
+		{"refs/tags/v1.0", "c3e5 e1f3 f7a9 a0b2", false},
+		// annotated, its page links to 8a2f
+		{"refs/tags/v2.0", "8a2f c3e5 e1f3 f7a9 a0b2", false},
+		{"f7a9c1e3b5d7f0a2c4e6b8d0f2a4c6e8b1d3f5a7", "f7a9 a0b2", false},
+	} {
+		opts := savedRepo()
+		opts.Branch = tc.branch
+		var hashes []string
+		opts.Commit = func(cmt CommitRecord) { hashes = append(hashes, cmt.Hash[:4]) }
+		scrape(t, opts)
+		if got := strings.Join(hashes, " "); got != tc.want {
+			t.Errorf("from %s counted %q, want %q", tc.branch, got, tc.want)
+		}
+		if IsBranchName(tc.branch) != tc.isBranch {
+			t.Errorf("IsBranchName(%s) = %v", tc.branch, !tc.isBranch)
+		}
+	}
+}
+
+func TestTagObjectLink(t *testing.T) {
+	link, err := Gitiles.(tagSource).TagObjectLink(parseTestPage(t, "tag-v2.0.html"), testRepo)
+	if want := testRepo + "/+/8a2f4c6e1b3d5f7a9c0e2b4d6f8a1c3e5b7d9f0a"; err != nil || link != want {
+		t.Errorf("TagObjectLink = %q, %v, want %q", link, err, want)
+	}
+	if _, err = Gitiles.CommitHash(parseTestPage(t, "tag-v2.0.html")); err == nil {
+		t.Error("the page of an annotated tag read as a commit page")
+	}
+	if link, err = Gitiles.(tagSource).TagObjectLink(parseTestPage(t, "main.html"), testRepo); err == nil {
+		t.Errorf("TagObjectLink of a commit page = %q", link)
+	}
+}
+
+func TestScrapeStopsAtRoot(t *testing.T) {
+	const root = "a0b2c4d6e8f1a3b5c7d9e0f2a4b6c8d1e3f5a7b9"
+	if parents, err := Gitiles.Parents(parseTestPage(t, root+".html")); err != nil || len(parents) != 0 {
+		t.Fatalf("saved root has parents %q, %v", parents, err)
+	}
+
+	// far more commits asked for than there are
+	opts := savedRepo()
+	opts.Count = 1000
+	var last string
+	opts.Commit = func(cmt CommitRecord) { last = cmt.Hash }
+	conts, err := Scrape(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Scrape = %v, want a clean stop at the root", err)
+	}
+	if last != root {
+		t.Errorf("last counted %s, want the root %s", last, root)
+	}
+	out := writeTestOutput(t, conts, OutputOptions{Format: "csv"})
+	if recs := readCSV(t, out, ','); len(recs) != 1+len(conts) || len(conts) == 0 {
+		t.Errorf("wrote %d records of %d contributors", len(recs), len(conts))
+	}
+}
+
+func TestScrapeRecordsMergeParents(t *testing.T) {
+	const merge = "f7a9c1e3b5d7f0a2c4e6b8d0f2a4c6e8b1d3f5a7"
+	want := []string{"a0b2c4d6e8f1a3b5c7d9e0f2a4b6c8d1e3f5a7b9", "9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c"}
+	opts := savedRepo()
+	opts.CommitsPath, opts.CommitFormat = t.TempDir(), "json"
+	var parents []string
+	opts.Commit = func(cmt CommitRecord) {
+		if cmt.Hash == merge {
+			parents = cmt.Parents
+		}
+	}
+	scrape(t, opts)
+
+	// both are recorded though only the first is walked
+	if !reflect.DeepEqual(parents, want) {
+		t.Errorf("Parents of the merge = %q, want %q", parents, want)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(opts.CommitsPath, merge+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec struct{ Parents []string }
+	if err = json.Unmarshal(b, &rec); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rec.Parents, want) {
+		t.Errorf("commit file holds parents %q, want %q", rec.Parents, want)
+	}
+}
+
+func TestScrapeMissingSavedPage(t *testing.T) {
+	opts := savedRepo()
+	// the second parent of the merge f7a9 isn't saved
+	opts.Branch = "9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d0c"
+	_, err := Scrape(context.Background(), opts)
+	if err == nil || !strings.Contains(err.Error(), "can't find saved page of") {
+		t.Errorf("err = %v, want a missing saved page", err)
+	}
+
+	// nor is the tip of another branch, whose link isn't on the repository page
+	opts.Branch = "stabilize-13904.B"
+	if _, err = Scrape(context.Background(), opts); err == nil {
+		t.Error("Scrape of a branch not saved succeeded")
+	}
+}
+
+func TestScrapeSavedPathLog(t *testing.T) {
+	opts := savedRepo()
+	opts.Path = "/src/example/"
+	var hashes []string
+	opts.Commit = func(cmt CommitRecord) { hashes = append(hashes, cmt.Hash[:4]) }
+	conts := scrape(t, opts)
+
+	// the listing of the path, not the first parents down to the root
+	if got, want := strings.Join(hashes, " "), "5d1e 8a2f c3e5 e1f3"; got != want {
+		t.Errorf("counted commits %q, want %q", got, want)
+	}
+	if _, ok := conts["Imported Author"]; !ok {
+		t.Errorf("no contribution of the author of e1f3 in %v", conts)
+	}
+
+	// nor is there a listing of another path to walk
+	opts.Path = "src/other"
+	if _, err := Scrape(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "without a log listing") {
+		t.Errorf("err = %v, want no listing of src/other", err)
+	}
+}
+
+func TestNewLogWalkerFetchError(t *testing.T) {
+	link := testRepo + "/+/5d1e7c0a9f3b42e6a8c1d0f7b2e9a4c6d3f8b1e0"
+	pages, err := dirPages(filepath.Join("..", "testdata", "gitiles"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the whole log isn't saved, that's no listing
+	if w, err := newLogWalker(parsed(pages), testRepo, link, ""); w != nil || err != nil {
+		t.Errorf("newLogWalker of an unsaved listing = %v, %v, want none", w, err)
+	}
+
+	fail := errors.New("connection reset")
+	failing := parsed(func(url string) (string, error) { return "", fail })
+	if w, err := newLogWalker(failing, testRepo, link, "src/example"); w != nil || !errors.Is(err, fail) {
+		t.Errorf("newLogWalker = %v, %v, want the fetch error", w, err)
+	}
+	opts := Options{RepoURL: testRepo, Branch: "5d1e7c0a9f3b42e6a8c1d0f7b2e9a4c6d3f8b1e0", Source: Gitiles}
+	if _, _, err := newWalker(opts, failing, ""); !errors.Is(err, fail) {
+		t.Errorf("newWalker = %v, want the fetch error rather than walking parents", err)
+	}
+}
@@ -0,0 +1,752 @@
+package contrib
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// countColumns names the counts of a Contribution in output order.
+var countColumns = []string{"created", "reviewed", "committed", "signed_off", "tested", "co_authored", "insertions",
+	"deletions"}
+
+func (c Contribution) counts() []float64 {
+	return []float64{c.Created, float64(c.Reviewed), float64(c.Committed), float64(c.SignedOff), float64(c.Tested),
+		float64(c.CoAuthored), float64(c.Insertions), float64(c.Deletions)}
+}
+
+// bucketColumns returns the trailer buckets counted in rows, sorted. They're
+// written after the countColumns.
+func bucketColumns(rows []row) []string {
+	seen := make(map[string]bool)
+	cols := make([]string, 0)
+	for _, r := range rows {
+		for b := range r.Buckets {
+			if !seen[b] {
+				seen[b] = true
+				cols = append(cols, b)
+			}
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// bucketName matches the names trailer buckets may have, usable as columns,
+// metric names and sql values alike.
+var bucketName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// ParseTrailerBuckets parses a list of bucket=key pairs, like
+// "acked=Acked-by:", into the key to bucket mapping of
+// Options.TrailerBuckets.
+func ParseTrailerBuckets(specs []string) (map[string]string, error) {
+	buckets := make(map[string]string)
+	for _, s := range specs {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("trailer bucket %q isn't bucket=key", s)
+		}
+		b, k := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !bucketName.MatchString(b) {
+			return nil, fmt.Errorf("bucket %q isn't lowercase letters, digits and underscores", b)
+		}
+		if isCountColumn(b) || isFixedColumn(b) {
+			return nil, fmt.Errorf("bucket %q is already a column", b)
+		}
+		buckets[k] = b
+	}
+	return buckets, nil
+}
+
+// isFixedColumn reports whether col is a column of the output besides the
+// counts.
+func isFixedColumn(col string) bool {
+	switch col {
+	case "name", "email", "first_commit", "last_commit", "score":
+		return true
+	}
+	return false
+}
+
+// formatCount prints whole counts without a fraction.
+func formatCount(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// formatDate prints t as RFC3339, or nothing if it's zero.
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// merge adds the counts of o to c.
+func (c *Contribution) merge(o Contribution) {
+	c.Created += o.Created
+	c.Reviewed += o.Reviewed
+	c.Committed += o.Committed
+	c.SignedOff += o.SignedOff
+	c.Tested += o.Tested
+	c.CoAuthored += o.CoAuthored
+	c.Insertions += o.Insertions
+	c.Deletions += o.Deletions
+	if len(o.Buckets) > 0 {
+		// copies of c share its map, don't add to theirs
+		buckets := make(map[string]int, len(c.Buckets)+len(o.Buckets))
+		for b, n := range c.Buckets {
+			buckets[b] = n
+		}
+		for b, n := range o.Buckets {
+			buckets[b] += n
+		}
+		c.Buckets = buckets
+	}
+	c.noteCommit(o.FirstCommit)
+	c.noteCommit(o.LastCommit)
+}
+
+// setCount sets the count of column col to f.
+func (c *Contribution) setCount(col string, f float64) {
+	switch col {
+	case "created":
+		c.Created = f
+	case "reviewed":
+		c.Reviewed = int(f)
+	case "committed":
+		c.Committed = int(f)
+	case "signed_off":
+		c.SignedOff = int(f)
+	case "tested":
+		c.Tested = int(f)
+	case "co_authored":
+		c.CoAuthored = int(f)
+	case "insertions":
+		c.Insertions = int(f)
+	case "deletions":
+		c.Deletions = int(f)
+	default:
+		buckets := map[string]int{col: int(f)}
+		for b, n := range c.Buckets {
+			if b != col {
+				buckets[b] = n
+			}
+		}
+		c.Buckets = buckets
+	}
+}
+
+// mergeAll returns the contributions of a and b added contributor by
+// contributor.
+func mergeAll(a, b map[string]Contribution) map[string]Contribution {
+	conts := make(map[string]Contribution, len(a)+len(b))
+	for _, m := range []map[string]Contribution{a, b} {
+		for k, c := range m {
+			if prev, ok := conts[k]; ok {
+				prev.merge(c)
+				c = prev
+			}
+			conts[k] = c
+		}
+	}
+	return conts
+}
+
+// Summary sums up a scrape.
+type Summary struct {
+	Contributors int
+	Commits      int
+	Reviews      int
+}
+
+// Summarize returns the summary of conts, scraped from commits commits. The
+// created counts don't add up to the commits: merged aliases and bots taken
+// out change them.
+func Summarize(conts map[string]Contribution, commits int) Summary {
+	s := Summary{Contributors: len(conts), Commits: commits}
+	for _, c := range conts {
+		s.Reviews += c.Reviewed
+	}
+	return s
+}
+
+// Weights are the points each count column is worth in a contributor's score.
+type Weights map[string]float64
+
+// DefaultWeights scores a created commit twice as much as a review or a
+// sign-off.
+var DefaultWeights = Weights{"created": 2, "reviewed": 1, "signed_off": 1}
+
+// ParseWeights parses a comma separated list of column=weight pairs, like
+// "created=2,reviewed=1", over DefaultWeights. Besides the count columns, the
+// buckets may be weighted.
+func ParseWeights(s string, buckets ...string) (Weights, error) {
+	w := make(Weights)
+	for k, v := range DefaultWeights {
+		w[k] = v
+	}
+	if s == "" {
+		return w, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("weight %q isn't column=weight", kv)
+		}
+		col := strings.TrimSpace(parts[0])
+		if !isCountColumn(col) && !containsString(buckets, col) {
+			return nil, fmt.Errorf("unknown column %q", col)
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("weight of %s: %v", col, err)
+		}
+		w[col] = n
+	}
+	return w, nil
+}
+
+func isCountColumn(col string) bool {
+	for _, c := range countColumns {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Weights) score(c Contribution) float64 {
+	s := 0.0
+	for i, n := range c.counts() {
+		s += w[countColumns[i]] * n
+	}
+	for b, n := range c.Buckets {
+		s += w[b] * float64(n)
+	}
+	return s
+}
+
+// OutputOptions configures WriteOutput.
+type OutputOptions struct {
+	Format string
+	// Weights computes the score column, DefaultWeights if nil.
+	Weights Weights
+	// Sort orders the rows: "score" (the default) by descending score,
+	// "name" alphabetically. Ties are broken by email, so the order is
+	// always the same for the same contributions.
+	Sort string
+	// Summary adds a TOTAL row summing each column, in the formats that
+	// have rows.
+	Summary bool
+	// Only, if not empty, restricts the rows written to the contributors
+	// whose name or email contains one of its elements, in any case.
+	Only []string
+	// Top, if above 0, is the most rows written, the first in Sort order.
+	// The TOTAL row still sums up all contributors. Appending to an output
+	// written with Top only adds to the rows it kept.
+	Top int
+	// Append adds the counts already in the output file to those written,
+	// for accumulating runs into one output. Only the formats CanAppend
+	// reports can be appended to.
+	Append bool
+	// Commits is the number of commits scraped, for the formats telling it.
+	Commits int
+}
+
+// row is a contributor as it's written out.
+type row struct {
+	key string
+	Contribution
+	Score float64 `json:"score"`
+}
+
+// HasSortOrder reports whether OutputOptions.Sort can be order.
+func HasSortOrder(order string) bool {
+	return order == "" || order == "score" || order == "name"
+}
+
+// rankedRows returns the rows of conts in the given order, ties broken by key.
+func rankedRows(conts map[string]Contribution, w Weights, order string) []row {
+	rows := make([]row, 0, len(conts))
+	for k, c := range conts {
+		rows = append(rows, row{key: k, Contribution: c, Score: w.score(c)})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if order == "name" {
+			if ni, nj := strings.ToLower(rows[i].Name), strings.ToLower(rows[j].Name); ni != nj {
+				return ni < nj
+			}
+		} else if rows[i].Score != rows[j].Score {
+			return rows[i].Score > rows[j].Score
+		}
+		return rows[i].key < rows[j].key
+	})
+	return rows
+}
+
+// filterContributors returns the contributions of conts whose name or email
+// contains one of only, in any case.
+func filterContributors(conts map[string]Contribution, only []string) map[string]Contribution {
+	filtered := make(map[string]Contribution)
+	for k, c := range conts {
+		name, email := strings.ToLower(c.Name), strings.ToLower(c.Email)
+		for _, o := range only {
+			o = strings.ToLower(o)
+			if strings.Contains(name, o) || strings.Contains(email, o) {
+				filtered[k] = c
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// totalRow returns the row summing up rows.
+func totalRow(rows []row) *row {
+	t := &row{Contribution: Contribution{Name: "TOTAL"}}
+	for _, r := range rows {
+		t.merge(r.Contribution)
+		t.Score += r.Score
+	}
+	return t
+}
+
+// outputFormats build the output from the ranked rows and, if a summary is
+// asked for, their total, with the columns of buckets.
+var outputFormats = map[string]func(rows []row, total *row, buckets []string) ([]byte, error){
+	"csv": func(rows []row, total *row, buckets []string) ([]byte, error) {
+		return []byte(buildCSVString(rows, total, buckets)), nil
+	},
+	"tsv": func(rows []row, total *row, buckets []string) ([]byte, error) {
+		return []byte(buildTSVString(rows, total, buckets)), nil
+	},
+	"json": buildJSON,
+	"html": buildHTML,
+	"md":   buildMarkdown,
+	// built in WriteOutput, with the commits scraped
+	"prom": nil,
+}
+
+// HasOutputFormat reports whether WriteOutput supports format.
+func HasOutputFormat(format string) bool {
+	_, ok := outputFormats[format]
+	return ok || IsStreamFormat(format)
+}
+
+// CanAppend reports whether outputs of format can be read back to append to.
+func CanAppend(format string) bool {
+	switch format {
+	case "csv", "tsv", "json":
+		return true
+	}
+	return IsStreamFormat(format)
+}
+
+// WriteOutput writes conts to the file at path, or to stdout if path is "-".
+// Paths ending in .gz are gzipped.
+func WriteOutput(conts map[string]Contribution, path string, opts OutputOptions) error {
+	build, ok := outputFormats[opts.Format]
+	if !ok {
+		return fmt.Errorf("unknown output format %q", opts.Format)
+	}
+	if opts.Format == "prom" {
+		build = func(rows []row, total *row, buckets []string) ([]byte, error) {
+			return buildProm(rows, buckets, opts.Commits)
+		}
+	}
+	w := opts.Weights
+	if w == nil {
+		w = DefaultWeights
+	}
+	if !HasSortOrder(opts.Sort) {
+		return fmt.Errorf("unknown sort order %q", opts.Sort)
+	}
+	if opts.Append {
+		prev, err := loadOutput(path, opts.Format)
+		if err != nil {
+			return fmt.Errorf("can't load %s to append to: %v", path, err)
+		}
+		conts = mergeAll(prev, conts)
+	}
+	if len(opts.Only) > 0 {
+		conts = filterContributors(conts, opts.Only)
+	}
+	rows := rankedRows(conts, w, opts.Sort)
+	var total *row
+	if opts.Summary {
+		total = totalRow(rows)
+	}
+	// the buckets of the rows cut by Top are still in the total
+	buckets := bucketColumns(rows)
+	if opts.Top > 0 && len(rows) > opts.Top {
+		rows = rows[:opts.Top]
+	}
+	out, err := build(rows, total, buckets)
+	if err != nil {
+		return err
+	}
+	if path == "-" {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	return writeOutputFile(path, out)
+}
+
+// buildJSON leaves total out, the consumer can sum the array.
+func buildJSON(rows []row, total *row, buckets []string) ([]byte, error) {
+	return json.MarshalIndent(rows, "", "  ")
+}
+
+func buildCSVString(rows []row, total *row, buckets []string) string {
+	return buildDelimited(rows, total, buckets, ',')
+}
+
+func buildTSVString(rows []row, total *row, buckets []string) string {
+	return buildDelimited(rows, total, buckets, '\t')
+}
+
+// buildDelimited writes the rows, separated by comma, through a csv.Writer into
+// a single buffer, so the time it takes grows linearly with the rows.
+func buildDelimited(rows []row, total *row, buckets []string, comma rune) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = comma
+	w.Write(delimitedHeader(buckets))
+	if total != nil {
+		rows = append(rows[:len(rows):len(rows)], *total)
+	}
+	for _, r := range rows {
+		w.Write(delimitedRecord(r, buckets))
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// delimitedHeader names the columns of the delimited formats, with those of
+// the trailer buckets after the counts.
+func delimitedHeader(buckets []string) []string {
+	header := append(append([]string{"name", "email"}, countColumns...), buckets...)
+	return append(header, "first_commit", "last_commit", "score")
+}
+
+func delimitedRecord(r row, buckets []string) []string {
+	rec := []string{r.Name, r.Email}
+	for _, n := range r.counts() {
+		rec = append(rec, formatCount(n))
+	}
+	for _, b := range buckets {
+		rec = append(rec, strconv.Itoa(r.Buckets[b]))
+	}
+	return append(rec, formatDate(r.FirstCommit), formatDate(r.LastCommit), formatCount(r.Score))
+}
+
+// htmlReport is the self-contained page of the html format.
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Contributions</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; }
+th { background: #f0f0f0; }
+td.n { text-align: right; }
+tfoot td { font-weight: bold; }
+</style>
+</head>
+<body>
+<table>
+<thead>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+</thead>
+<tbody>
+{{- range .Rows}}
+<tr>{{range $i, $c := .}}<td{{if gt $i 1}} class="n"{{end}}>{{$c}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+{{- if .Total}}
+<tfoot>
+<tr>{{range $i, $c := .Total}}<td{{if gt $i 1}} class="n"{{end}}>{{$c}}</td>{{end}}</tr>
+</tfoot>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// buildHTML renders the rows as a table, with the same columns as csv.
+func buildHTML(rows []row, total *row, buckets []string) ([]byte, error) {
+	data := struct {
+		Header []string
+		Rows   [][]string
+		Total  []string
+	}{Header: delimitedHeader(buckets)}
+	for _, r := range rows {
+		data.Rows = append(data.Rows, delimitedRecord(r, buckets))
+	}
+	if total != nil {
+		data.Total = delimitedRecord(*total, buckets)
+	}
+	var buf bytes.Buffer
+	if err := htmlReport.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// buildMarkdown renders the rows as a github flavored markdown table, with
+// the same columns as csv and the counts aligned right.
+func buildMarkdown(rows []row, total *row, buckets []string) ([]byte, error) {
+	var buf bytes.Buffer
+	header := delimitedHeader(buckets)
+	writeMarkdownRow(&buf, header)
+	sep := make([]string, len(header))
+	for i := range sep {
+		sep[i] = "---"
+		if i > 1 {
+			sep[i] = "---:"
+		}
+	}
+	writeMarkdownRow(&buf, sep)
+	if total != nil {
+		rows = append(rows[:len(rows):len(rows)], *total)
+	}
+	for _, r := range rows {
+		writeMarkdownRow(&buf, delimitedRecord(r, buckets))
+	}
+	return buf.Bytes(), nil
+}
+
+// markdownCell escapes what would end a cell or the row.
+var markdownCell = strings.NewReplacer("|", "\\|", "\n", " ")
+
+func writeMarkdownRow(buf *bytes.Buffer, cells []string) {
+	buf.WriteString("|")
+	for _, c := range cells {
+		buf.WriteString(" " + markdownCell.Replace(c) + " |")
+	}
+	buf.WriteString("\n")
+}
+
+// promLabel escapes a label value of the prometheus text format.
+var promLabel = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+// promHelp describes the gauges of buildProm.
+var promHelp = map[string]string{
+	"created":     "Commits created",
+	"reviewed":    "Commits reviewed",
+	"committed":   "Commits committed",
+	"signed_off":  "Commits signed off",
+	"tested":      "Commits tested",
+	"co_authored": "Commits co-authored",
+	"insertions":  "Lines inserted",
+	"deletions":   "Lines deleted",
+	"score":       "Score earned",
+}
+
+// buildProm writes the rows as gauges of the prometheus text format, for
+// the textfile collector of node_exporter, labelled by contributor key and
+// name, and the trailer buckets as gauges of their own. The total is left
+// out, it's a sum away, but the commits scraped are given as
+// contributions_scrape_commits_total.
+func buildProm(rows []row, buckets []string, commits int) ([]byte, error) {
+	var buf bytes.Buffer
+	cols := append(append(countColumns[:len(countColumns):len(countColumns)], buckets...), "score")
+	for i, col := range cols {
+		name := "contributions_" + col
+		help, ok := promHelp[col]
+		if !ok {
+			help = "Commits counted as " + col
+		}
+		fmt.Fprintf(&buf, "# HELP %s %s by each contributor.\n# TYPE %s gauge\n", name, help, name)
+		for _, r := range rows {
+			v := r.Score
+			if i < len(countColumns) {
+				v = r.counts()[i]
+			} else if i < len(countColumns)+len(buckets) {
+				v = float64(r.Buckets[col])
+			}
+			fmt.Fprintf(&buf, "%s{contributor=\"%s\",name=\"%s\"} %s\n", name, promLabel.Replace(r.key),
+				promLabel.Replace(r.Name), formatCount(v))
+		}
+	}
+	fmt.Fprintf(&buf, "# HELP contributions_scrape_commits_total Commits scraped.\n")
+	fmt.Fprintf(&buf, "# TYPE contributions_scrape_commits_total counter\n")
+	fmt.Fprintf(&buf, "contributions_scrape_commits_total %d\n", commits)
+	return buf.Bytes(), nil
+}
+
+// WriteBugs writes how many commits referenced each bug to the file at path
+// as csv, the most referenced first.
+func WriteBugs(bugs map[string]int, path string) error {
+	keys := make([]string, 0, len(bugs))
+	for b := range bugs {
+		keys = append(keys, b)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if bugs[keys[i]] != bugs[keys[j]] {
+			return bugs[keys[i]] > bugs[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"bug", "commits"})
+	for _, b := range keys {
+		w.Write([]string{b, strconv.Itoa(bugs[b])})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeOutputFile(path, buf.Bytes())
+}
+
+// commitsHeader names the columns of the rows of commitRow.
+func commitsHeader(withRepo bool) []string {
+	header := []string{"hash", "author", "committer", "date", "reviewers", "insertions", "deletions"}
+	if withRepo {
+		header = append(header, "repo")
+	}
+	return header
+}
+
+func commitRow(cmt CommitRecord, withRepo bool) []string {
+	row := []string{cmt.Hash, cmt.Author, cmt.Committer, formatDate(cmt.Date), strconv.Itoa(len(cmt.Reviewers)),
+		strconv.Itoa(cmt.Insertions), strconv.Itoa(cmt.Deletions)}
+	if withRepo {
+		row = append(row, cmt.Repo)
+	}
+	return row
+}
+
+// WriteCommits writes a row for each of cmts to the file at path as csv, the
+// latest first, with a repo column if they were scraped from several.
+func WriteCommits(cmts []CommitRecord, path string) error {
+	withRepo := false
+	for _, cmt := range cmts {
+		withRepo = withRepo || cmt.Repo != ""
+	}
+	sorted := append([]CommitRecord(nil), cmts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Date.Equal(sorted[j].Date) {
+			return sorted[i].Date.After(sorted[j].Date)
+		}
+		return sorted[i].Hash < sorted[j].Hash
+	})
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(commitsHeader(withRepo))
+	for _, cmt := range sorted {
+		w.Write(commitRow(cmt, withRepo))
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeOutputFile(path, buf.Bytes())
+}
+
+// loadOutput reads back the contributions of an output written by
+// WriteOutput in format, nil if there's no file at path. Columns missing from
+// the file are taken as zero, so outputs of older versions still load, and
+// unknown ones holding counts are taken as trailer buckets. The TOTAL row and
+// scores are dropped, they're derived.
+func loadOutput(path, format string) (map[string]Contribution, error) {
+	b, err := readOutputFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Contribution
+	switch format {
+	case "csv", "tsv":
+		r := csv.NewReader(bytes.NewReader(b))
+		if format == "tsv" {
+			r.Comma = '\t'
+		}
+		r.FieldsPerRecord = -1
+		recs, err := r.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(recs) == 0 {
+			return nil, nil
+		}
+		header := recs[0]
+		for _, rec := range recs[1:] {
+			var c Contribution
+			for i, col := range header {
+				if i >= len(rec) {
+					break
+				}
+				switch {
+				case col == "name":
+					c.Name = rec[i]
+				case col == "email":
+					c.Email = rec[i]
+				case (col == "first_commit" || col == "last_commit") && rec[i] != "":
+					t, err := time.Parse(time.RFC3339, rec[i])
+					if err != nil {
+						return nil, fmt.Errorf("%s of %s: %v", col, c.Name, err)
+					}
+					c.noteCommit(t)
+				case isCountColumn(col):
+					f, err := strconv.ParseFloat(rec[i], 64)
+					if err != nil {
+						return nil, fmt.Errorf("%s of %s: %v", col, c.Name, err)
+					}
+					c.setCount(col, f)
+				case !isFixedColumn(col) && bucketName.MatchString(col):
+					if f, err := strconv.ParseFloat(rec[i], 64); err == nil {
+						c.setCount(col, f)
+					}
+				}
+			}
+			if c.Name == "TOTAL" && c.Email == "" {
+				continue
+			}
+			list = append(list, c)
+		}
+	case "json":
+		if err = json.Unmarshal(b, &list); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("can't load output format %q", format)
+	}
+
+	conts := make(map[string]Contribution, len(list))
+	for _, c := range list {
+		k := contributorKey(c.Name, c.Email)
+		if m, ok := conts[k]; ok {
+			m.merge(c)
+			c = m
+		}
+		conts[k] = c
+	}
+	return conts, nil
+}
@@ -0,0 +1,743 @@
+package contrib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// testConts are the contributions of two people.
+func testConts() map[string]Contribution {
+	return map[string]Contribution{
+		"jdoe@chromium.org": {Name: "Jane Doe", Email: "jdoe@chromium.org", Created: 3, Reviewed: 1},
+		"jroe@chromium.org": {Name: "John Roe", Email: "jroe@chromium.org", Created: 1, Reviewed: 4, SignedOff: 1},
+	}
+}
+
+// writeTestOutput writes conts with opts to a temporary file and returns what
+// was written.
+func writeTestOutput(t testing.TB, conts map[string]Contribution, opts OutputOptions) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "out."+opts.Format)
+	if err := WriteOutput(conts, path, opts); err != nil {
+		t.Fatalf("WriteOutput: %v", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// readCSV parses s, failing t if it isn't valid csv.
+func readCSV(t testing.TB, s string, comma rune) [][]string {
+	t.Helper()
+	r := csv.NewReader(strings.NewReader(s))
+	r.Comma = comma
+	recs, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("can't parse %q: %v", s, err)
+	}
+	return recs
+}
+
+func TestBuildCSVStringQuotes(t *testing.T) {
+	name, email := splitContributor("Doe, John <j@x.com>")
+	conts := map[string]Contribution{
+		contributorKey(name, email): {Name: name, Email: email, Created: 1},
+		"jroe@chromium.org":         {Name: `John "JR" Roe`, Email: "jroe@chromium.org", Reviewed: 1},
+	}
+
+	rows := rankedRows(conts, DefaultWeights, "name")
+	recs := readCSV(t, buildCSVString(rows, nil, bucketColumns(rows)), ',')
+	if len(recs) != 3 {
+		t.Fatalf("got %d records, want a header and 2 rows: %q", len(recs), recs)
+	}
+	header := recs[0]
+	for _, rec := range recs[1:] {
+		if len(rec) != len(header) {
+			t.Errorf("row %q has %d fields, want %d", rec, len(rec), len(header))
+		}
+	}
+	if recs[1][0] != "Doe, John" || recs[1][1] != "j@x.com" {
+		t.Errorf("first row starts with %q, %q, want %q, %q", recs[1][0], recs[1][1], "Doe, John", "j@x.com")
+	}
+	if recs[2][0] != `John "JR" Roe` {
+		t.Errorf("second row name = %q, want %q", recs[2][0], `John "JR" Roe`)
+	}
+}
+
+func TestWriteOutputFormats(t *testing.T) {
+	for _, tc := range []struct {
+		format string
+		comma  rune
+	}{
+		{"csv", ','},
+		{"tsv", '\t'},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			recs := readCSV(t, writeTestOutput(t, testConts(), OutputOptions{Format: tc.format, Sort: "name"}), tc.comma)
+			if len(recs) != 3 {
+				t.Fatalf("got %d records, want 3: %q", len(recs), recs)
+			}
+			if got := strings.Join(recs[0][:4], " "); got != "name email created reviewed" {
+				t.Errorf("header starts with %q", got)
+			}
+			if recs[1][0] != "Jane Doe" || recs[1][2] != "3" || recs[2][0] != "John Roe" || recs[2][3] != "4" {
+				t.Errorf("rows = %q", recs[1:])
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var rows []struct {
+			Name     string  `json:"name"`
+			Email    string  `json:"email"`
+			Created  float64 `json:"created"`
+			Reviewed int     `json:"reviewed"`
+		}
+		out := writeTestOutput(t, testConts(), OutputOptions{Format: "json", Sort: "name"})
+		if err := json.Unmarshal([]byte(out), &rows); err != nil {
+			t.Fatalf("can't parse %s: %v", out, err)
+		}
+		if len(rows) != 2 || rows[0].Name != "Jane Doe" || rows[0].Created != 3 || rows[1].Email != "jroe@chromium.org" ||
+			rows[1].Reviewed != 4 {
+			t.Errorf("rows = %+v", rows)
+		}
+	})
+}
+
+func TestTrailerBucketColumns(t *testing.T) {
+	buckets, err := ParseTrailerBuckets([]string{"qa_verified=QA-Verified:", " acked = Acked-by: "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := offlineRepo(t, linear(
+		testCommit{hash: "c2f0", author: "Jane Doe <jdoe@chromium.org>",
+			msg: "Second\n\nQA-Verified: Alex Poe <apoe@google.com>\nAcked-by: John Roe <jroe@chromium.org>\n"},
+		testCommit{hash: "c1f0", author: "Jane Doe <jdoe@chromium.org>", msg: "First\n\nqa-verified: Alex Poe <apoe@google.com>\n"},
+	)...)
+	opts.TrailerBuckets = buckets
+	conts := scrape(t, opts)
+	w, err := ParseWeights("qa_verified=10", "qa_verified", "acked")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recs := readCSV(t, writeTestOutput(t, conts, OutputOptions{Format: "csv", Weights: w}), ',')
+	col := make(map[string]int)
+	for i, h := range recs[0] {
+		col[h] = i
+	}
+	qa, acked := col["qa_verified"], col["acked"]
+	if qa == 0 || acked == 0 || qa < col["deletions"] {
+		t.Fatalf("header %q lacks the bucket columns after the counts", recs[0])
+	}
+	rows := make(map[string][]string)
+	for _, rec := range recs[1:] {
+		rows[rec[1]] = rec
+	}
+	for _, tc := range []struct {
+		email, qa, acked, score string
+	}{
+		{"apoe@google.com", "2", "0", "20"},
+		{"jroe@chromium.org", "0", "1", "0"},
+		{"jdoe@chromium.org", "0", "0", "4"},
+	} {
+		rec := rows[tc.email]
+		if rec == nil || rec[qa] != tc.qa || rec[acked] != tc.acked || rec[col["score"]] != tc.score {
+			t.Errorf("row of %s = %q, want qa_verified %s, acked %s, score %s", tc.email, rec, tc.qa, tc.acked, tc.score)
+		}
+	}
+
+	for _, specs := range [][]string{{"reviewed=Reviewed-by:"}, {"QA=QA-Verified:"}, {"qa"}, {"score=Approved-by:"}} {
+		if _, err := ParseTrailerBuckets(specs); err == nil {
+			t.Errorf("ParseTrailerBuckets(%q) succeeded", specs)
+		}
+	}
+}
+
+func TestWriteOutputUnknownFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.xml")
+	if err := WriteOutput(testConts(), path, OutputOptions{Format: "xml"}); err == nil {
+		t.Error("WriteOutput of format xml succeeded")
+	}
+	if HasOutputFormat("xml") {
+		t.Error("HasOutputFormat(xml) = true")
+	}
+}
+
+func TestScoreOrdering(t *testing.T) {
+	conts := map[string]Contribution{
+		"a@chromium.org": {Name: "A", Email: "a@chromium.org", Created: 1, Reviewed: 1},
+		"b@chromium.org": {Name: "B", Email: "b@chromium.org", Created: 2, SignedOff: 3},
+		"c@chromium.org": {Name: "C", Email: "c@chromium.org", Reviewed: 5},
+		"d@chromium.org": {Name: "D", Email: "d@chromium.org", Created: 2, Reviewed: 1},
+	}
+	for _, tc := range []struct {
+		weights string
+		want    string
+	}{
+		// ties broken by email
+		{"", "B:7 C:5 D:5 A:3"},
+		{"created=1,reviewed=2", "C:10 B:5 D:4 A:3"},
+		{"signed_off=0,reviewed=0.5", "D:4.5 B:4 A:2.5 C:2.5"},
+	} {
+		t.Run(tc.weights, func(t *testing.T) {
+			w, err := ParseWeights(tc.weights)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range rankedRows(conts, w, "") {
+				got = append(got, r.Name+":"+formatCount(r.Score))
+			}
+			if strings.Join(got, " ") != tc.want {
+				t.Errorf("ranked %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	recs := readCSV(t, writeTestOutput(t, conts, OutputOptions{Format: "csv"}), ',')
+	last := len(recs[0]) - 1
+	if recs[0][last] != "score" || recs[1][0] != "B" || recs[1][last] != "7" {
+		t.Errorf("wrote %q, want B first with a score of 7", recs)
+	}
+}
+
+func TestParseWeightsErrors(t *testing.T) {
+	for _, s := range []string{"created", "lines=1", "created=many"} {
+		if _, err := ParseWeights(s); err == nil {
+			t.Errorf("ParseWeights(%q) succeeded", s)
+		}
+	}
+	if w, err := ParseWeights("bug=3", "bug"); err != nil || w["bug"] != 3 || w["created"] != 2 {
+		t.Errorf("ParseWeights of a bucket = %v, %v", w, err)
+	}
+}
+
+func TestWriteOutputSummary(t *testing.T) {
+	conts := testConts()
+	recs := readCSV(t, writeTestOutput(t, conts, OutputOptions{Format: "csv", Sort: "name", Summary: true}), ',')
+	if len(recs) != 4 {
+		t.Fatalf("got %d records, want a header, 2 rows and a total: %q", len(recs), recs)
+	}
+	total := recs[3]
+	if total[0] != "TOTAL" {
+		t.Fatalf("last row is %q, want TOTAL", total)
+	}
+	for i, col := range recs[0] {
+		if col == "name" || col == "email" || strings.HasSuffix(col, "_commit") {
+			continue
+		}
+		sum := 0.0
+		for _, rec := range recs[1:3] {
+			n, err := strconv.ParseFloat(rec[i], 64)
+			if err != nil {
+				t.Fatalf("%s of %q: %v", col, rec, err)
+			}
+			sum += n
+		}
+		if got := total[i]; got != formatCount(sum) {
+			t.Errorf("TOTAL %s = %s, want %s", col, got, formatCount(sum))
+		}
+	}
+
+	s := Summarize(conts, 5)
+	if s != (Summary{Contributors: 2, Commits: 5, Reviews: 5}) {
+		t.Errorf("Summarize = %+v", s)
+	}
+}
+
+func TestWriteOutputTop(t *testing.T) {
+	conts := manyConts(50)
+	sum := 0.0
+	for _, c := range conts {
+		sum += c.Created
+	}
+	recs := readCSV(t, writeTestOutput(t, conts, OutputOptions{Format: "csv", Top: 3, Summary: true}), ',')
+	if len(recs) != 5 {
+		t.Fatalf("got %d records, want a header, 3 rows and a total: %q", len(recs), recs)
+	}
+	best := rankedRows(conts, DefaultWeights, "score")
+	for i, rec := range recs[1:4] {
+		if rec[1] != best[i].Email {
+			t.Errorf("row %d is of %s, want %s", i, rec[1], best[i].Email)
+		}
+	}
+	// the total is still of everyone
+	if total := recs[4]; total[0] != "TOTAL" || total[2] != formatCount(sum) {
+		t.Errorf("total %q, want TOTAL created %s", total, formatCount(sum))
+	}
+
+	var rows []row
+	if err := json.Unmarshal([]byte(writeTestOutput(t, conts, OutputOptions{Format: "json", Top: 3})), &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Errorf("wrote %d json rows, want 3", len(rows))
+	}
+	// no more rows than there are
+	if recs = readCSV(t, writeTestOutput(t, testConts(), OutputOptions{Format: "csv", Top: 3}), ','); len(recs) != 3 {
+		t.Errorf("got %d records of 2 contributors, want a header and 2 rows", len(recs))
+	}
+
+	// the buckets of the rows cut are still columns, for the total
+	conts = testConts()
+	conts["x@chromium.org"] = Contribution{Name: "X", Email: "x@chromium.org", Buckets: map[string]int{"bug": 1}}
+	recs = readCSV(t, writeTestOutput(t, conts, OutputOptions{Format: "csv", Top: 2, Summary: true}), ',')
+	header, total := recs[0], recs[len(recs)-1]
+	if i := len(countColumns) + 2; len(header) <= i || header[i] != "bug" || total[i] != "1" {
+		t.Errorf("header %q with total %q, want a bug column counting 1", header, total)
+	}
+}
+
+// gunzip reads the whole gzipped file at path, failing t if it's cut short.
+func gunzip(t testing.TB, path string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%s isn't gzipped: %v", path, err)
+	}
+	out, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("can't read %s back: %v", path, err)
+	}
+	return string(out)
+}
+
+func TestWriteOutputGzip(t *testing.T) {
+	conts := manyConts(200)
+	for _, format := range []string{"csv", "json", "md"} {
+		opts := OutputOptions{Format: format, Summary: true}
+		path := filepath.Join(t.TempDir(), "out."+format+".gz")
+		if err := WriteOutput(conts, path, opts); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := gunzip(t, path), writeTestOutput(t, conts, opts); got != want {
+			t.Errorf("%s: read back %d bytes, want the %d written without gzip", format, len(got), len(want))
+		}
+	}
+
+	// and appended to
+	path := filepath.Join(t.TempDir(), "out.csv.gz")
+	opts := OutputOptions{Format: "csv", Sort: "name", Append: true}
+	for i := 0; i < 2; i++ {
+		if err := WriteOutput(testConts(), path, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recs := readCSV(t, gunzip(t, path), ',')
+	if len(recs) != 3 || recs[1][2] != "6" {
+		t.Errorf("appended to %q, want Jane Doe's 3 created twice", recs)
+	}
+}
+
+func TestBuildCSVStringDeterministic(t *testing.T) {
+	conts := make(map[string]Contribution)
+	for i := 0; i < 50; i++ {
+		email := fmt.Sprintf("dev%d@chromium.org", i)
+		// many ties in score, broken by email
+		conts[email] = Contribution{Name: fmt.Sprint("Dev ", i%7), Email: email, Created: float64(i % 3), Reviewed: i % 5}
+	}
+	for _, order := range []string{"score", "name"} {
+		rows := rankedRows(conts, DefaultWeights, order)
+		first := buildCSVString(rows, nil, bucketColumns(rows))
+		for i := 0; i < 10; i++ {
+			rows = rankedRows(conts, DefaultWeights, order)
+			if again := buildCSVString(rows, nil, bucketColumns(rows)); again != first {
+				t.Fatalf("%s order: run %d wrote\n%s\nafter\n%s", order, i, again, first)
+			}
+		}
+		if !strings.HasPrefix(first, "name,email,") {
+			t.Errorf("%s order: output doesn't start with the header: %.40q", order, first)
+		}
+	}
+}
+
+// manyConts are the contributions of n people, some named with a comma or a
+// quote to escape.
+func manyConts(n int) map[string]Contribution {
+	conts := make(map[string]Contribution, n)
+	for i := 0; i < n; i++ {
+		email := fmt.Sprintf("dev%d@chromium.org", i)
+		name := fmt.Sprint("Dev ", i)
+		switch i % 10 {
+		case 1:
+			name = fmt.Sprintf("Doe, Dev %d", i)
+		case 2:
+			name = fmt.Sprintf(`Dev "%d" Doe`, i)
+		}
+		conts[email] = Contribution{Name: name, Email: email, Created: float64(i % 13), Reviewed: i % 7, Committed: i % 3,
+			Buckets: map[string]int{"bug": i % 5}}
+	}
+	return conts
+}
+
+// concatCSV builds the csv of conts the way it was before csv.Writer, adding
+// each record to the string, in the order of the map.
+func concatCSV(conts map[string]Contribution, w Weights) string {
+	var rows []row
+	for k, c := range conts {
+		rows = append(rows, row{key: k, Contribution: c, Score: w.score(c)})
+	}
+	buckets := bucketColumns(rows)
+	quote := func(rec []string) string {
+		for i, f := range rec {
+			if strings.ContainsAny(f, ",\"\r\n") || strings.HasPrefix(f, " ") {
+				rec[i] = `"` + strings.ReplaceAll(f, `"`, `""`) + `"`
+			}
+		}
+		return strings.Join(rec, ",") + "\n"
+	}
+	s := quote(delimitedHeader(buckets))
+	for _, r := range rows {
+		s += quote(delimitedRecord(r, buckets))
+	}
+	return s
+}
+
+func BenchmarkBuildCSVString(b *testing.B) {
+	conts := manyConts(10000)
+	b.Run("concat", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			concatCSV(conts, DefaultWeights)
+		}
+	})
+	b.Run("writer", func(b *testing.B) {
+		rows := rankedRows(conts, DefaultWeights, "score")
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			buildCSVString(rows, nil, bucketColumns(rows))
+		}
+	})
+}
+
+func TestBuildCSVStringLikeConcat(t *testing.T) {
+	conts := manyConts(1000)
+	rows := rankedRows(conts, DefaultWeights, "score")
+	got := strings.SplitAfter(buildCSVString(rows, nil, bucketColumns(rows)), "\n")
+	want := strings.SplitAfter(concatCSV(conts, DefaultWeights), "\n")
+	if got[0] != want[0] {
+		t.Errorf("header = %q, want %q", got[0], want[0])
+	}
+	// the same records but for their order
+	got, want = got[1:], want[1:]
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("wrote %d lines, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("wrote %q, want %q", got[i], want[i])
+		}
+	}
+}
+
+// captureStdout returns what f writes to stdout.
+func captureStdout(t testing.TB, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	out := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		out <- b
+	}()
+	f()
+	w.Close()
+	return string(<-out)
+}
+
+func TestWriteOutputStdout(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	out := captureStdout(t, func() {
+		if err := WriteOutput(testConts(), "-", OutputOptions{Format: "csv", Sort: "name"}); err != nil {
+			t.Errorf("WriteOutput: %v", err)
+		}
+	})
+	if want := writeTestOutput(t, testConts(), OutputOptions{Format: "csv", Sort: "name"}); out != want {
+		t.Errorf("wrote %q to stdout, want %q", out, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "-")); !os.IsNotExist(err) {
+		t.Errorf("wrote a file called -: %v", err)
+	}
+}
+
+func TestWriteBugs(t *testing.T) {
+	bugs := make(map[string]int)
+	for _, msg := range []string{"A\n\nBug: 123456\n", "B\n\nBUG=chromium:123456\n", "C\n\nBUG=chromium:654321\n"} {
+		for _, b := range getBugs(msg) {
+			bugs[b]++
+		}
+	}
+	path := filepath.Join(t.TempDir(), "bugs.csv")
+	if err := WriteBugs(bugs, path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "bug,commits\n123456,2\n654321,1\n"; string(b) != want {
+		t.Errorf("wrote %q, want %q", b, want)
+	}
+}
+
+func TestWriteOutputAppend(t *testing.T) {
+	for _, format := range []string{"csv", "tsv", "json"} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out."+format)
+			opts := OutputOptions{Format: format, Sort: "name", Append: true, Summary: true}
+			// a missing file is a first run
+			if err := WriteOutput(testConts(), path, opts); err != nil {
+				t.Fatal(err)
+			}
+			second := map[string]Contribution{
+				"jdoe@chromium.org": {Name: "Jane Doe", Email: "jdoe@chromium.org", Created: 2},
+				"apoe@google.com":   {Name: "Alex Poe", Email: "apoe@google.com", Reviewed: 1},
+			}
+			if err := WriteOutput(second, path, opts); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := loadOutput(path, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string][2]float64{
+				"jdoe@chromium.org": {5, 1},
+				"jroe@chromium.org": {1, 4},
+				"apoe@google.com":   {0, 1},
+			}
+			if len(got) != len(want) {
+				t.Errorf("got %d contributors, want %d, the TOTAL row left out: %v", len(got), len(want), got)
+			}
+			for k, w := range want {
+				if c := got[k]; c.Created != w[0] || float64(c.Reviewed) != w[1] {
+					t.Errorf("%s: Created, Reviewed = %v, %d, want %v, %v", k, c.Created, c.Reviewed, w[0], w[1])
+				}
+			}
+			if c := got["jroe@chromium.org"]; c.SignedOff != 1 {
+				t.Errorf("SignedOff = %d, want 1", c.SignedOff)
+			}
+		})
+	}
+}
+
+func TestWriteOutputAppendOldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv")
+	// written before the later columns were added, in another order
+	writeTestFile(t, path, "email,name,reviewed,created\njdoe@chromium.org,Jane Doe,1,3\n")
+	second := map[string]Contribution{
+		"jdoe@chromium.org": {Name: "Jane Doe", Email: "jdoe@chromium.org", Created: 1, SignedOff: 2},
+	}
+	if err := WriteOutput(second, path, OutputOptions{Format: "csv", Append: true}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadOutput(path, "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := got["jdoe@chromium.org"]; c.Created != 4 || c.Reviewed != 1 || c.SignedOff != 2 {
+		t.Errorf("merged %+v", c)
+	}
+}
+
+func TestWriteOutputOnly(t *testing.T) {
+	conts := testConts()
+	conts["asmith@google.com"] = Contribution{Name: "Alice Smith", Email: "asmith@google.com", Created: 7}
+	conts["bwong@chromium.org"] = Contribution{Name: "Bob Wong", Email: "bwong@chromium.org", Reviewed: 2}
+	conts["Jane Doe"] = Contribution{Name: "Jane Doe", Created: 1}
+
+	// by email, and by name in any case
+	recs := readCSV(t, writeTestOutput(t, conts, OutputOptions{Format: "csv", Sort: "name", Summary: true,
+		Only: []string{"jroe@", "SMITH"}}), ',')
+	if len(recs) != 4 {
+		t.Fatalf("got %d records, want a header, 2 rows and a total: %q", len(recs), recs)
+	}
+	if recs[1][0] != "Alice Smith" || recs[2][0] != "John Roe" {
+		t.Errorf("kept %q and %q, want Alice Smith and John Roe", recs[1][0], recs[2][0])
+	}
+	if created := recs[3][2]; created != "8" {
+		t.Errorf("TOTAL created = %s, want only the kept rows summed to 8", created)
+	}
+
+	// both contributors named Jane Doe, with and without an email
+	recs = readCSV(t, writeTestOutput(t, conts, OutputOptions{Format: "csv", Sort: "name", Only: []string{"jane"}}), ',')
+	if len(recs) != 3 {
+		t.Errorf("got %d records, want a header and 2 rows: %q", len(recs), recs)
+	}
+
+	recs = readCSV(t, writeTestOutput(t, conts, OutputOptions{Format: "csv", Only: []string{"nobody"}}), ',')
+	if len(recs) != 1 {
+		t.Errorf("got %d records matching nobody, want only the header: %q", len(recs), recs)
+	}
+}
+
+func TestWriteOutputHTML(t *testing.T) {
+	conts := testConts()
+	conts["evil@chromium.org"] = Contribution{Name: "<script>alert(1)</script> & Co", Email: "evil@chromium.org", Created: 2}
+	out := writeTestOutput(t, conts, OutputOptions{Format: "html", Sort: "name", Summary: true})
+	if strings.Contains(out, "<script>") {
+		t.Errorf("name written unescaped in %s", out)
+	}
+
+	doc := parseString(t, out)
+	body := findNode(doc, func(n *html.Node) bool { return isElement(n, "tbody") })
+	if body == nil {
+		t.Fatalf("no tbody in %s", out)
+	}
+	rows := findAll(body, func(n *html.Node) bool { return isElement(n, "tr") })
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	first := findNode(rows[0], func(n *html.Node) bool { return isElement(n, "td") })
+	if got := textContent(first); got != "<script>alert(1)</script> & Co" {
+		t.Errorf("first name reads %q", got)
+	}
+	header := findAll(doc, func(n *html.Node) bool { return isElement(n, "th") })
+	if len(header) == 0 || textContent(header[0]) != "name" {
+		t.Error("no name column header")
+	}
+	foot := findNode(doc, func(n *html.Node) bool { return isElement(n, "tfoot") })
+	if foot == nil || !strings.HasPrefix(strings.TrimSpace(textContent(foot)), "TOTAL") {
+		t.Error("no TOTAL row in the footer")
+	}
+
+	for _, format := range []string{"html", "md", "prom"} {
+		if CanAppend(format) {
+			t.Errorf("CanAppend(%s) = true", format)
+		}
+	}
+}
+
+func TestWriteOutputMarkdown(t *testing.T) {
+	conts := testConts()
+	conts["pipe@chromium.org"] = Contribution{Name: "Pat | Pipe", Email: "pipe@chromium.org", Created: 2}
+	out := writeTestOutput(t, conts, OutputOptions{Format: "md", Sort: "name", Summary: true})
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("got %d lines, want a header, a separator, 3 rows and a total:\n%s", len(lines), out)
+	}
+
+	// the cells of a row, | escaped within them
+	cells := func(line string) []string {
+		if !strings.HasPrefix(line, "| ") || !strings.HasSuffix(line, " |") {
+			t.Fatalf("%q isn't a table row", line)
+		}
+		var l []string
+		for _, c := range strings.Split(strings.Replace(line[2:len(line)-2], `\|`, "\x00", -1), " | ") {
+			l = append(l, strings.Replace(c, "\x00", "|", -1))
+		}
+		return l
+	}
+	header := cells(lines[0])
+	if header[0] != "name" || header[1] != "email" || header[2] != "created" {
+		t.Errorf("header = %q", header)
+	}
+	sep := cells(lines[1])
+	if len(sep) != len(header) || sep[0] != "---" || sep[2] != "---:" {
+		t.Errorf("separator = %q, want --- for names and ---: for counts", sep)
+	}
+	var names []string
+	for _, l := range lines[2:] {
+		c := cells(l)
+		if len(c) != len(header) {
+			t.Errorf("row %q has %d cells, want %d", l, len(c), len(header))
+		}
+		names = append(names, c[0])
+	}
+	if got := strings.Join(names, ", "); got != "Jane Doe, John Roe, Pat | Pipe, TOTAL" {
+		t.Errorf("rows are %s", got)
+	}
+	if !strings.Contains(out, `| Pat \| Pipe |`) {
+		t.Errorf("the | of a name isn't escaped:\n%s", out)
+	}
+	if total := cells(lines[5]); total[2] != "6" {
+		t.Errorf("TOTAL created = %s, want 6", total[2])
+	}
+}
+
+func TestWriteOutputProm(t *testing.T) {
+	conts := testConts()
+	conts[`q"b\@chromium.org`] = Contribution{Name: `Quo"te \ Slash`, Email: `q"b\@chromium.org`, Created: 1,
+		Buckets: map[string]int{"bug": 2}}
+	out := writeTestOutput(t, conts, OutputOptions{Format: "prom", Sort: "name", Summary: true, Commits: 7})
+
+	// every line a comment or a sample, the samples of a metric after its
+	// HELP and TYPE
+	sample := regexp.MustCompile(`^([a-z_]+)(\{contributor="(?:[^"\\]|\\.)*",name="(?:[^"\\]|\\.)*"\})? (\S+)$`)
+	typed := map[string]string{}
+	samples := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if f := strings.Fields(line); len(f) >= 4 && f[0] == "#" && f[1] == "TYPE" {
+			typed[f[2]] = f[3]
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		m := sample.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("%q isn't a sample", line)
+			continue
+		}
+		if typed[m[1]] == "" {
+			t.Errorf("%q comes before the TYPE of %s", line, m[1])
+		}
+		if _, err := strconv.ParseFloat(m[3], 64); err != nil {
+			t.Errorf("%q has a value that isn't a number", line)
+		}
+		samples[m[1]+m[2]] = m[3]
+	}
+	for metric, want := range map[string]string{
+		`contributions_created{contributor="jdoe@chromium.org",name="Jane Doe"}`:       "3",
+		`contributions_reviewed{contributor="jroe@chromium.org",name="John Roe"}`:      "4",
+		`contributions_bug{contributor="q\"b\\@chromium.org",name="Quo\"te \\ Slash"}`: "2",
+		`contributions_bug{contributor="jdoe@chromium.org",name="Jane Doe"}`:           "0",
+		// the commits scraped, not those the rows created
+		`contributions_scrape_commits_total`: "7",
+	} {
+		if got := samples[metric]; got != want {
+			t.Errorf("%s = %q, want %q", metric, got, want)
+		}
+	}
+	if typed["contributions_created"] != "gauge" || typed["contributions_scrape_commits_total"] != "counter" {
+		t.Errorf("types = %v", typed)
+	}
+	if strings.Contains(out, "TOTAL") {
+		t.Error("wrote the total")
+	}
+}
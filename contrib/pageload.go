@@ -0,0 +1,109 @@
+package contrib
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mafredri/cdp"
+	"github.com/mafredri/cdp/protocol/page"
+	"github.com/mafredri/cdp/rpcc"
+)
+
+// HasWaitFor reports whether Options.WaitFor can be event.
+func HasWaitFor(event string) bool {
+	return event == "" || event == "domcontent" || event == "load" || event == "networkidle"
+}
+
+// pageLoad tells when a page navigated to in a tab has loaded.
+type pageLoad interface {
+	// drain drops the events of earlier pages that timed out before they
+	// fired.
+	drain() error
+	// wait blocks until the page of nav has loaded.
+	wait(ctx context.Context, nav *page.NavigateReply) error
+	close() error
+}
+
+// subscribeLoad subscribes c to the event of Options.WaitFor: the
+// DOMContentLoaded event for "domcontent", the default, the load event for
+// "load", and the networkIdle lifecycle event, fired once the page made no
+// requests for a while, for "networkidle".
+func subscribeLoad(ctx context.Context, c *cdp.Client, event string) (pageLoad, error) {
+	switch event {
+	case "", "domcontent":
+		s, err := c.Page.DOMContentEventFired(ctx)
+		return streamLoad{s}, err
+	case "load":
+		s, err := c.Page.LoadEventFired(ctx)
+		return streamLoad{s}, err
+	case "networkidle":
+		if err := c.Page.SetLifecycleEventsEnabled(ctx, page.NewSetLifecycleEventsEnabledArgs(true)); err != nil {
+			return nil, err
+		}
+		s, err := c.Page.LifecycleEvent(ctx)
+		return lifecycleLoad{s}, err
+	default:
+		return nil, fmt.Errorf("unknown page load event %q", event)
+	}
+}
+
+// streamLoad takes the first event of its stream after navigating as the
+// page having loaded.
+type streamLoad struct {
+	s rpcc.Stream
+}
+
+func (l streamLoad) drain() error {
+	for {
+		select {
+		case <-l.s.Ready():
+			var b []byte
+			if err := l.s.RecvMsg(&b); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (l streamLoad) close() error { return l.s.Close() }
+
+func (l streamLoad) wait(ctx context.Context, nav *page.NavigateReply) error {
+	select {
+	case <-l.s.Ready():
+		var b []byte
+		return l.s.RecvMsg(&b)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// lifecycleLoad waits for the networkIdle event of the frame navigated,
+// skipping the other lifecycle events and those of other frames.
+type lifecycleLoad struct {
+	s page.LifecycleEventClient
+}
+
+func (l lifecycleLoad) drain() error {
+	return streamLoad{l.s}.drain()
+}
+
+func (l lifecycleLoad) close() error { return l.s.Close() }
+
+func (l lifecycleLoad) wait(ctx context.Context, nav *page.NavigateReply) error {
+	for {
+		select {
+		case <-l.s.Ready():
+			ev, err := l.s.Recv()
+			if err != nil {
+				return err
+			}
+			if ev.Name == "networkIdle" && ev.FrameID == nav.FrameID && (nav.LoaderID == nil || ev.LoaderID == *nav.LoaderID) {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
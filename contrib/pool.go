@@ -0,0 +1,123 @@
+package contrib
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// poolResult is a commit read by a worker of poolCommits.
+type poolResult struct {
+	cmt  CommitRecord
+	err  error
+	shot []byte
+}
+
+// poolCommits lists commits from the log in one tab and reads their pages
+// in opts.Concurrency others at once. Commits are still yielded in the order
+// of the log, so the walk stops at the same commits it would serially.
+type poolCommits struct {
+	ctx context.Context
+	// slots delivers, in log order, where the result of each commit will
+	// be sent once read.
+	slots chan chan poolResult
+	shots *shotSaver
+}
+
+type poolJob struct {
+	entry logEntry
+	slot  chan poolResult
+}
+
+func (b *browser) poolCommits(ctx context.Context, opts Options, lim *limiter, w *logWalker, src Source, shots *shotSaver) (*poolCommits, error) {
+	fetchers := make([]fetchFunc, 0, opts.Concurrency)
+	tabs := make([]*tab, 0, opts.Concurrency)
+	for i := 0; i < opts.Concurrency; i++ {
+		t, err := b.openTab(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		tabs = append(tabs, t)
+		fetchers = append(fetchers, t.fetcher(ctx, opts, lim))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	b.stopWorkers = func() {
+		cancel()
+		wg.Wait()
+	}
+
+	p := &poolCommits{ctx: ctx, slots: make(chan chan poolResult, opts.Concurrency), shots: shots}
+	jobs := make(chan poolJob)
+
+	// list the commits
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(p.slots)
+		defer close(jobs)
+		for {
+			e, err := w.nextEntry()
+			slot := make(chan poolResult, 1)
+			if err != nil {
+				if err != io.EOF {
+					slot <- poolResult{err: err}
+					select {
+					case p.slots <- slot:
+					case <-ctx.Done():
+					}
+				}
+				return
+			}
+			select {
+			case p.slots <- slot:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- poolJob{entry: e, slot: slot}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// read their pages
+	for i := range tabs {
+		t, fetch := tabs[i], fetchers[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				var r poolResult
+				doc, url, err := j.entry.page(fetch, w.repurl, w.commitPages)
+				if err != nil {
+					r.err = err
+				} else {
+					r.cmt, r.err = parsePage(src, doc, url)
+				}
+				r.shot, t.shot = t.shot, nil
+				j.slot <- r
+			}
+		}()
+	}
+	return p, nil
+}
+
+func (p *poolCommits) next() (CommitRecord, error) {
+	slot, ok := <-p.slots
+	if !ok {
+		return CommitRecord{}, io.EOF
+	}
+	var r poolResult
+	select {
+	case r = <-slot:
+	case <-p.ctx.Done():
+		return CommitRecord{}, p.ctx.Err()
+	}
+	if err := p.shots.save(r.cmt.Hash, r.shot); err != nil {
+		return r.cmt, err
+	}
+	return r.cmt, r.err
+}
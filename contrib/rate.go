@@ -0,0 +1,66 @@
+package contrib
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter spaces calls at least 1/rate seconds apart, across all the tabs
+// sharing it. A nil limiter doesn't limit anything.
+type limiter struct {
+	ctx      context.Context
+	interval time.Duration
+	// mu is held while waiting, so callers go through one at a time.
+	mu sync.Mutex
+	// last is when the last call went through, zero before the first.
+	last time.Time
+}
+
+// newLimiter returns the limiter of rate calls per second, nil if rate is
+// zero or less.
+func newLimiter(ctx context.Context, rate float64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{ctx: ctx, interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// wait blocks until interval has passed since the last call went through,
+// the first one going right away. It gives up as soon as ctx is done.
+func (l *limiter) wait() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.last.IsZero() {
+		if d := time.Until(l.last.Add(l.interval)); d > 0 {
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			select {
+			case <-l.ctx.Done():
+				return l.ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+	if err := l.ctx.Err(); err != nil {
+		return err
+	}
+	l.last = time.Now()
+	return nil
+}
+
+// withRate waits on lim before each call to fetch.
+func withRate(fetch pageFunc, lim *limiter) pageFunc {
+	if lim == nil {
+		return fetch
+	}
+	return func(url string) (string, error) {
+		if err := lim.wait(); err != nil {
+			return "", err
+		}
+		return fetch(url)
+	}
+}
@@ -0,0 +1,82 @@
+package contrib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithRateSpacesCalls(t *testing.T) {
+	const rate = 20
+	interval := time.Second / rate
+	var calls []time.Time
+	fetch := withRate(func(url string) (string, error) {
+		calls = append(calls, time.Now())
+		return "", nil
+	}, newLimiter(context.Background(), rate))
+
+	for i := 0; i < 5; i++ {
+		if _, err := fetch("page"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i < len(calls); i++ {
+		// leave the timer some slack
+		if gap := calls[i].Sub(calls[i-1]); gap < interval*9/10 {
+			t.Errorf("call %d came %v after the previous one, want at least %v", i, gap, interval)
+		}
+	}
+}
+
+func TestLimiterAfterLateCaller(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	lim := newLimiter(context.Background(), float64(time.Second/interval))
+	if err := lim.wait(); err != nil {
+		t.Fatal(err)
+	}
+	// arrive late, just before a second interval is over
+	time.Sleep(interval * 9 / 5)
+	if err := lim.wait(); err != nil {
+		t.Fatal(err)
+	}
+	late := time.Now()
+	// and right after the late one, a whole interval still has to pass
+	if err := lim.wait(); err != nil {
+		t.Fatal(err)
+	}
+	if gap := time.Since(late); gap < interval*9/10 {
+		t.Errorf("the call after a late one came %v after it, want at least %v", gap, interval)
+	}
+}
+
+func TestLimiterStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lim := newLimiter(ctx, 0.01)
+	if err := lim.wait(); err != nil {
+		t.Fatalf("first wait: %v", err)
+	}
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if err := lim.wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait = %v, want context.Canceled", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("wait took %v past the cancel", took)
+	}
+}
+
+func TestNoLimiter(t *testing.T) {
+	if lim := newLimiter(context.Background(), 0); lim != nil {
+		t.Errorf("newLimiter(0) = %v, want nil", lim)
+	}
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := (*limiter)(nil).wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if took := time.Since(start); took > 100*time.Millisecond {
+		t.Errorf("unlimited waits took %v", took)
+	}
+}
@@ -0,0 +1,106 @@
+package contrib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ScrapeRepos walks the history opts describes in each of repos, parallel of
+// them at a time, and returns the contributions found in all of them counted
+// together. Each repo is walked in a tab of its own, of a browser launched
+// once for all if opts asks for it. Commits are passed to opts.Commit one at
+// a time, with their Repo set, and opts.Progress is told the commits counted
+// in all repos. A repo failing stops the others. If ctx is done midway, the
+// contributions of the commits scraped until then are returned with an
+// ErrIncomplete error.
+func ScrapeRepos(ctx context.Context, opts Options, repos []string, parallel int) (map[string]Contribution, error) {
+	if opts.Checkpoint != "" {
+		return nil, fmt.Errorf("can't resume from checkpoints when scraping several repos")
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+	if opts.Launch && opts.HTMLDir == "" && opts.Backend != "gerrit" {
+		stop, err := launchChrome(ctx, opts.DevTools)
+		if err != nil {
+			return nil, err
+		}
+		defer stop()
+	}
+	opts.Launch = false
+	opts.NewTab = true
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	conts := make(map[string]Contribution)
+	counted := make([]int, len(repos))
+	var failed, cut error
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, repo := range repos {
+		i, repo := i, repo
+		ropts := opts
+		ropts.RepoURL = repo
+		ropts.Commit = func(cmt CommitRecord) {
+			cmt.Repo = repo
+			mu.Lock()
+			defer mu.Unlock()
+			if opts.Commit != nil {
+				opts.Commit(cmt)
+			}
+		}
+		ropts.Progress = func(done, total int) {
+			mu.Lock()
+			defer mu.Unlock()
+			counted[i] = done
+			if opts.Progress != nil {
+				sum := 0
+				for _, n := range counted {
+					sum += n
+				}
+				opts.Progress(sum, opts.Count*len(repos))
+			}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				mu.Lock()
+				cut = incomplete(ctx)
+				mu.Unlock()
+				return
+			}
+			defer func() { <-sem }()
+
+			c, err := Scrape(ctx, ropts)
+			mu.Lock()
+			defer mu.Unlock()
+			conts = mergeAll(conts, c)
+			switch {
+			case err == nil:
+			case errors.Is(err, ErrIncomplete):
+				cut = err
+			case failed == nil:
+				failed = fmt.Errorf("%s: %w", repo, err)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failed != nil {
+		return nil, failed
+	}
+	if opts.ResolveNames {
+		// names resolve to emails seen in other repos too
+		resolveNames(conts)
+	}
+	return conts, cut
+}
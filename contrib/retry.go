@@ -0,0 +1,110 @@
+package contrib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+)
+
+// retryBaseDelay is the delay before the first retry, a var for tests to
+// shorten.
+var retryBaseDelay = 500 * time.Millisecond
+
+// throttleBaseDelay and throttleMaxDelay bound the backoff after the server
+// throttled a page, which takes longer to go away than other failures,
+// vars for tests to shorten.
+var (
+	throttleBaseDelay = 5 * time.Second
+	throttleMaxDelay  = 2 * time.Minute
+)
+
+// navigationError is reported when the browser fails to load a page.
+type navigationError struct {
+	url, text string
+}
+
+func (e *navigationError) Error() string {
+	return fmt.Sprintf("navigating to %s: %s", e.url, e.text)
+}
+
+// throttledError is reported when the server answered with a page telling
+// it's throttling us instead of the page asked for.
+type throttledError struct {
+	url string
+}
+
+func (e *throttledError) Error() string {
+	return fmt.Sprintf("throttled by the server at %s", e.url)
+}
+
+// throttleTitle matches the titles of the pages served instead when
+// throttled, like "Error 429 (Too Many Requests)!!1".
+var throttleTitle = regexp.MustCompile(`(?is)<title>[^<]*(\b429\b|too many requests|resource exhausted)[^<]*</title>`)
+
+// isThrottlePage reports whether page is one telling that we're throttled.
+// Only the title is looked at, commit messages may mention anything.
+func isThrottlePage(page string) bool {
+	return throttleTitle.MatchString(page)
+}
+
+// permanentNavigationErrors are the net errors that won't go away by trying
+// again, mostly malformed or unresolvable urls.
+var permanentNavigationErrors = map[string]bool{
+	"net::ERR_INVALID_URL":              true,
+	"net::ERR_UNKNOWN_URL_SCHEME":       true,
+	"net::ERR_DISALLOWED_URL_SCHEME":    true,
+	"net::ERR_NAME_NOT_RESOLVED":        true,
+	"net::ERR_INVALID_REDIRECT":         true,
+	"net::ERR_UNSAFE_REDIRECT":          true,
+	"net::ERR_BLOCKED_BY_CLIENT":        true,
+	"net::ERR_BLOCKED_BY_ADMINISTRATOR": true,
+}
+
+// isRetryable reports whether err may go away by trying again. Timeouts of
+// a single page are, as long as the context of the whole scrape isn't done,
+// but a browser given up on isn't.
+func isRetryable(err error) bool {
+	if errors.Is(err, errBrowserLost) {
+		return false
+	}
+	var nerr *navigationError
+	if errors.As(err, &nerr) {
+		return !permanentNavigationErrors[nerr.text]
+	}
+	return true
+}
+
+// withRetry retries fetch up to retries more times on retryable errors,
+// doubling the delay between attempts. It gives up as soon as ctx is done.
+func withRetry(ctx context.Context, fetch pageFunc, retries int) pageFunc {
+	return func(url string) (string, error) {
+		delay := retryBaseDelay
+		for i := 0; ; i++ {
+			r, err := fetch(url)
+			if err == nil || i >= retries || ctx.Err() != nil || !isRetryable(err) {
+				return r, err
+			}
+
+			wait := delay
+			var terr *throttledError
+			if errors.As(err, &terr) {
+				wait = throttleBaseDelay << i
+				if wait > throttleMaxDelay || wait <= 0 {
+					wait = throttleMaxDelay
+				}
+				slog.Warn("throttled by the server, backing off", "url", url, "attempt", i+1, "delay", wait)
+			} else {
+				slog.Warn("retrying page", "url", url, "attempt", i+1, "delay", wait, "err", err)
+			}
+			select {
+			case <-ctx.Done():
+				return "", err
+			case <-time.After(wait):
+			}
+			delay *= 2
+		}
+	}
+}
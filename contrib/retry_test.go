@@ -0,0 +1,78 @@
+package contrib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// shortDelays shortens the retry delays for the duration of t.
+func shortDelays(t *testing.T) {
+	base := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = base })
+}
+
+// failingPages fails the first fails calls with err, then serves page,
+// counting the calls in n.
+func failingPages(fails int, err error, page string, n *int) pageFunc {
+	return func(url string) (string, error) {
+		*n++
+		if *n <= fails {
+			return "", err
+		}
+		return page, nil
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	shortDelays(t)
+	timeout := errors.New("timed out")
+	badURL := &navigationError{url: "bad", text: "net::ERR_INVALID_URL"}
+	for _, tc := range []struct {
+		name      string
+		fails     int
+		err       error
+		retries   int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"fails twice", 2, timeout, 3, 3, false},
+		{"out of retries", 2, timeout, 1, 2, true},
+		{"no retries", 1, timeout, 0, 1, true},
+		{"permanent", 1, badURL, 3, 1, true},
+		{"reset connection", 2, &navigationError{text: "net::ERR_CONNECTION_RESET"}, 3, 3, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			fetch := withRetry(context.Background(), failingPages(tc.fails, tc.err, "page", &calls), tc.retries)
+			r, err := fetch(testRepo)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("err = %v, want error %v", err, tc.wantErr)
+			}
+			if err == nil && r != "page" {
+				t.Errorf("got %q, want page", r)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("fetched %d times, want %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWithRetryStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	fetch := withRetry(ctx, func(url string) (string, error) {
+		calls++
+		cancel()
+		return "", errors.New("timed out")
+	}, 3)
+	if _, err := fetch(testRepo); err == nil {
+		t.Error("fetch succeeded")
+	}
+	if calls != 1 {
+		t.Errorf("fetched %d times once the context was done, want 1", calls)
+	}
+}
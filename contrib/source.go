@@ -0,0 +1,162 @@
+package contrib
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Source reads the pages of one kind of code hosting site.
+type Source interface {
+	// MainLink returns the url of the commit page at the tip of branch,
+	// given the repository page at repurl.
+	MainLink(doc *html.Node, repurl, branch string) (string, error)
+
+	CommitHash(doc *html.Node) (string, error)
+	Author(doc *html.Node) (string, error)
+	AuthorDate(doc *html.Node) (time.Time, error)
+	Committer(doc *html.Node) (string, error)
+	Message(doc *html.Node) (string, error)
+
+	// CommitLink returns the url of the commit page of hash.
+	CommitLink(repurl, hash string) (string, error)
+	// ParentLink returns the url of the commit page of the first parent, or
+	// "" for a root commit.
+	ParentLink(doc *html.Node, repurl string) (string, error)
+	// Parents returns the hashes of all the parents of the commit.
+	Parents(doc *html.Node) ([]string, error)
+
+	Reviewers(msg string) ([]string, error)
+}
+
+// logSource is implemented by sources that can list many commits per page.
+type logSource interface {
+	// newLogWalker returns nil if there's no listing, and an error if it
+	// can't be fetched.
+	newLogWalker(fetch fetchFunc, repurl, mainLink, path string) (commitWalker, error)
+}
+
+// refSource is implemented by sources that can tell the url of the commit
+// page at the tip of a branch without looking it up.
+type refSource interface {
+	RefLink(repurl, branch string) (string, error)
+}
+
+// tagSource is implemented by sources showing annotated tags on a page of
+// their own, which links to the commit tagged.
+type tagSource interface {
+	// TagObjectLink returns the url of the page of the object tagged.
+	TagObjectLink(doc *html.Node, repurl string) (string, error)
+}
+
+// diffstatSource is implemented by sources whose commit pages tell how many
+// lines changed.
+type diffstatSource interface {
+	Diffstat(doc *html.Node) (insertions, deletions int)
+}
+
+// filesSource is implemented by sources whose commit pages list the files
+// changed.
+type filesSource interface {
+	// Files returns the paths changed, nil if doc doesn't list them.
+	Files(doc *html.Node) []string
+}
+
+var (
+	// Gitiles reads gitiles commit pages, like those of
+	// chromium.googlesource.com.
+	Gitiles Source = gitiles{}
+	// GitHub reads github.com commit pages.
+	GitHub Source = github{}
+)
+
+var sources = map[string]Source{
+	"gitiles": Gitiles,
+	"github":  GitHub,
+}
+
+// SourceFor returns the source called name, or the one matching the host of
+// repurl if name is empty.
+func SourceFor(name, repurl string) (Source, error) {
+	if name == "" {
+		u, err := url.Parse(repurl)
+		if err == nil && strings.TrimPrefix(u.Hostname(), "www.") == "github.com" {
+			return GitHub, nil
+		}
+		return Gitiles, nil
+	}
+	src, ok := sources[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q", name)
+	}
+	return src, nil
+}
+
+type gitiles struct{}
+
+func (gitiles) MainLink(doc *html.Node, repurl, branch string) (string, error) {
+	return getMainLink(doc, repurl, branch)
+}
+
+// RefLink returns the canonical refs/heads link, so a tag or another branch
+// named alike is never taken for the branch, or the refs/tags one of tags.
+func (gitiles) RefLink(repurl, branch string) (string, error) {
+	if strings.HasPrefix(branch, tagPrefix) {
+		return url.JoinPath(repurl, "+", branch)
+	}
+	return url.JoinPath(repurl, "+", "refs", "heads", branch)
+}
+
+func (gitiles) TagObjectLink(doc *html.Node, repurl string) (string, error) {
+	return getTagObjectLink(doc, repurl)
+}
+
+func (gitiles) CommitHash(doc *html.Node) (string, error)    { return getCommitHash(doc) }
+func (gitiles) Author(doc *html.Node) (string, error)        { return getAuthor(doc) }
+func (gitiles) AuthorDate(doc *html.Node) (time.Time, error) { return getAuthorDate(doc) }
+func (gitiles) Committer(doc *html.Node) (string, error)     { return getCommitter(doc) }
+func (gitiles) Message(doc *html.Node) (string, error)       { return getCommitMessage(doc) }
+
+func (gitiles) CommitLink(repurl, hash string) (string, error) { return commitLink(repurl, hash) }
+
+func (gitiles) ParentLink(doc *html.Node, repurl string) (string, error) {
+	return getParentCommitLink(doc, repurl)
+}
+
+func (gitiles) Parents(doc *html.Node) ([]string, error) { return getParents(doc) }
+
+func (gitiles) Reviewers(msg string) ([]string, error) { return getReviewers(msg) }
+
+func (gitiles) Diffstat(doc *html.Node) (int, int) {
+	n := findNode(doc, func(n *html.Node) bool { return hasClass(n, "DiffSummary") })
+	if n == nil {
+		return 0, 0
+	}
+	return parseDiffstat(textContent(n), "insertion", "deletion")
+}
+
+func (gitiles) Files(doc *html.Node) []string {
+	tree := findNode(doc, func(n *html.Node) bool { return isElement(n, "ul") && hasClass(n, "DiffTree") })
+	if tree == nil {
+		return nil
+	}
+	files := make([]string, 0)
+	for _, li := range findAll(tree, func(n *html.Node) bool { return isElement(n, "li") }) {
+		// the first link is the file, the others its diff
+		if a := findNode(li, func(n *html.Node) bool { return isElement(n, "a") }); a != nil {
+			files = append(files, strings.TrimSpace(textContent(a)))
+		}
+	}
+	return files
+}
+
+func (gitiles) newLogWalker(fetch fetchFunc, repurl, mainLink, path string) (commitWalker, error) {
+	// don't return a typed nil
+	if w, err := newLogWalker(fetch, repurl, mainLink, path); w != nil || err != nil {
+		return w, err
+	}
+	return nil, nil
+}
@@ -0,0 +1,80 @@
+package contrib
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sort"
+)
+
+// unknownMonth is the bucket of commits without a date.
+const unknownMonth = "unknown"
+
+// TimeSeries counts contributions month by month, from the month each commit
+// was authored in, in UTC.
+type TimeSeries struct {
+	months      map[string]*tally
+	aliases     map[string]string
+	bots        []string
+	splitCredit bool
+}
+
+// NewTimeSeries returns an empty series counting contributors the way opts
+// has Scrape count them.
+func NewTimeSeries(opts Options) *TimeSeries {
+	return &TimeSeries{months: make(map[string]*tally), aliases: opts.Aliases, bots: opts.Bots,
+		splitCredit: opts.SplitCredit}
+}
+
+// Add counts cmt in the month it was authored, or the unknown one if it has
+// no date.
+func (s *TimeSeries) Add(cmt CommitRecord) {
+	month := unknownMonth
+	if !cmt.Date.IsZero() {
+		month = cmt.Date.UTC().Format("2006-01")
+	}
+	t, ok := s.months[month]
+	if !ok {
+		t = newTally(s.aliases, s.bots)
+		s.months[month] = t
+	}
+	t.count(cmt, s.splitCredit)
+}
+
+// Write writes the series to the file at path as csv, a row per month and
+// contributor who created or reviewed anything in it, oldest first and the
+// unknown month last.
+func (s *TimeSeries) Write(path string) error {
+	months := make([]string, 0, len(s.months))
+	for m := range s.months {
+		months = append(months, m)
+	}
+	sort.Slice(months, func(i, j int) bool {
+		if (months[i] == unknownMonth) != (months[j] == unknownMonth) {
+			return months[j] == unknownMonth
+		}
+		return months[i] < months[j]
+	})
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"month", "contributor", "created", "reviewed"})
+	for _, m := range months {
+		conts := s.months[m].conts
+		keys := make([]string, 0, len(conts))
+		for k, c := range conts {
+			if c.Created > 0 || c.Reviewed > 0 {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			c := conts[k]
+			w.Write([]string{m, k, formatCount(c.Created), formatCount(float64(c.Reviewed))})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeOutputFile(path, buf.Bytes())
+}
@@ -0,0 +1,44 @@
+package contrib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestTimeSeries(t *testing.T) {
+	jane, john := "Jane Doe <jdoe@chromium.org>", "John Roe <jroe@chromium.org>"
+	opts := offlineRepo(t, linear(
+		// March in UTC, though still February where it was authored
+		testCommit{hash: "c4f0", author: jane, date: "Sun Feb 28 20:00:00 2021 -0800", msg: "Fourth\n"},
+		testCommit{hash: "c3f0", author: john, date: "Mon Feb 15 10:00:00 2021 +0000",
+			msg: "Third\n\nReviewed-by: " + jane + "\n"},
+		testCommit{hash: "c2f0", author: jane, date: "Wed Feb 03 10:00:00 2021 +0000",
+			msg: "Second\n\nReviewed-by: " + john + "\n"},
+		testCommit{hash: "c1f0", author: jane, date: "Thu Jan 28 10:00:00 2021 +0000", msg: "First\n"},
+	)...)
+	series := NewTimeSeries(opts)
+	opts.Commit = series.Add
+	scrape(t, opts)
+	// a commit whose date couldn't be read
+	series.Add(CommitRecord{Hash: "c0f0", Author: john})
+
+	path := filepath.Join(t.TempDir(), "series.csv")
+	if err := series.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `month,contributor,created,reviewed
+2021-01,jdoe@chromium.org,1,0
+2021-02,jdoe@chromium.org,1,1
+2021-02,jroe@chromium.org,1,1
+2021-03,jdoe@chromium.org,1,0
+unknown,jroe@chromium.org,1,0
+`
+	if string(b) != want {
+		t.Errorf("wrote\n%s\nwant\n%s", b, want)
+	}
+}
@@ -0,0 +1,177 @@
+package contrib
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+type fetchFunc func(url string) (*html.Node, error)
+
+// commitWalker yields the commit page (or an equivalent subtree) of each
+// visited commit, newest first, and the url it was read from. It returns
+// io.EOF once history is exhausted.
+type commitWalker interface {
+	next() (*html.Node, string, error)
+}
+
+// parentWalker navigates to one commit page at a time, following the parent
+// link of the page it just fetched, until a commit without parents.
+type parentWalker struct {
+	fetch  fetchFunc
+	src    Source
+	repurl string
+	link   string
+}
+
+func (w *parentWalker) next() (*html.Node, string, error) {
+	url := w.link
+	if url == "" {
+		// the last commit was the root
+		return nil, url, io.EOF
+	}
+	p, err := w.fetch(url)
+	if err != nil {
+		return nil, url, err
+	}
+
+	w.link, err = w.src.ParentLink(p, w.repurl)
+	if err != nil {
+		return nil, url, err
+	}
+	return p, url, nil
+}
+
+// logWalker reads commits in bulk from the paginated gitiles log listing and
+// only navigates to a commit page when the listing lacks its full message.
+type logWalker struct {
+	fetch   fetchFunc
+	repurl  string
+	page    string
+	entries []logEntry
+	// commitPages has every commit read from its page, the listing being
+	// only used to find them.
+	commitPages bool
+}
+
+// logEntry is a commit listed on the log page at url.
+type logEntry struct {
+	hash string
+	node *html.Node
+	url  string
+}
+
+func (w *logWalker) next() (*html.Node, string, error) {
+	e, err := w.nextEntry()
+	if err != nil {
+		return nil, w.page, err
+	}
+	return e.page(w.fetch, w.repurl, w.commitPages)
+}
+
+// nextEntry returns the next commit listed, reading the following log page
+// when the current one is used up.
+func (w *logWalker) nextEntry() (logEntry, error) {
+	for len(w.entries) == 0 {
+		if w.page == "" {
+			return logEntry{}, io.EOF
+		}
+		p, err := w.fetch(w.page)
+		if err != nil {
+			return logEntry{}, err
+		}
+		w.entries, w.page, err = getLogEntries(p, w.page, w.repurl)
+		if err != nil {
+			return logEntry{}, err
+		}
+	}
+
+	e := w.entries[0]
+	w.entries = w.entries[1:]
+	return e, nil
+}
+
+// page returns the listing of the commit if it's complete and commitPage
+// isn't set, or else fetches its commit page, along with the url of either.
+func (e logEntry) page(fetch fetchFunc, repurl string, commitPage bool) (*html.Node, string, error) {
+	if _, err := getCommitMessage(e.node); err == nil && !commitPage {
+		return e.node, e.url, nil
+	}
+	link, err := commitLink(repurl, e.hash)
+	if err != nil {
+		return nil, e.url, err
+	}
+	p, err := fetch(link)
+	return p, link, err
+}
+
+// newLogWalker fetches the first log page of the history behind mainLink,
+// only that of the files under path if it's set, and returns nil if there's
+// no such page or it can't be read as a commit listing.
+func newLogWalker(fetch fetchFunc, repurl, mainLink, path string) (*logWalker, error) {
+	if !strings.Contains(mainLink, "/+/") {
+		return nil, nil
+	}
+	page := strings.Replace(mainLink, "/+/", "/+log/", 1)
+	if path != "" {
+		var err error
+		if page, err = url.JoinPath(page, strings.Trim(path, "/")); err != nil {
+			return nil, err
+		}
+	}
+	page += "?pretty=full"
+
+	p, err := fetch(page)
+	if errors.Is(err, errNoSavedPage) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries, next, err := getLogEntries(p, page, repurl)
+	if err != nil {
+		slog.Debug("not a log listing", "url", page, "err", err)
+		return nil, nil
+	}
+	return &logWalker{fetch: fetch, repurl: repurl, page: next, entries: entries}, nil
+}
+
+// getLogEntries returns the commits listed on the gitiles log page at url and
+// the link to the following page, which is empty on the last one.
+func getLogEntries(doc *html.Node, url, repurl string) ([]logEntry, string, error) {
+	var entries []logEntry
+	items := findAll(doc, func(n *html.Node) bool {
+		return isElement(n, "li") && hasClass(n, "CommitLog-item")
+	})
+	for _, li := range items {
+		if h := getLogEntryHash(li); h != "" {
+			entries = append(entries, logEntry{hash: h, node: li, url: url})
+		}
+	}
+	if len(entries) == 0 {
+		return nil, "", fmt.Errorf("can't find log entries!")
+	}
+
+	next := ""
+	if a := findNode(doc, func(n *html.Node) bool { return isElement(n, "a") && hasClass(n, "LogNav-next") }); a != nil {
+		var err error
+		if next, err = resolveLink(repurl, getAttr(a, "href")); err != nil {
+			return nil, "", err
+		}
+	}
+	return entries, next, nil
+}
+
+func getLogEntryHash(li *html.Node) string {
+	a := findNode(li, func(n *html.Node) bool { return isElement(n, "a") && hasClass(n, "CommitLog-sha1") })
+	if a == nil {
+		return ""
+	}
+	href := getAttr(a, "href")
+	return href[strings.LastIndex(href, "/")+1:]
+}
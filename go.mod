@@ -1,8 +1,23 @@
 module github.com/mido3ds/gsoc-chromium-starter
 
-go 1.15
+go 1.21
 
 require (
+	github.com/gorilla/websocket v1.4.2
 	github.com/mafredri/cdp v0.31.0
 	golang.org/x/net v0.0.0-20201021035429-f5854403a974
+	gopkg.in/yaml.v3 v3.0.1
+	modernc.org/sqlite v1.34.5
+)
+
+require (
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	modernc.org/libc v1.55.3 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
 )
@@ -2,358 +2,692 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
-	"strconv"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/mafredri/cdp"
-	"github.com/mafredri/cdp/devtool"
-	"github.com/mafredri/cdp/protocol/dom"
-	"github.com/mafredri/cdp/protocol/page"
-	"github.com/mafredri/cdp/rpcc"
-	"golang.org/x/net/html"
+	"github.com/mido3ds/gsoc-chromium-starter/contrib"
 )
 
 func main() {
 	cnumber := flag.Int("cnumber", 10, "num of commits to load")
 	repurl := flag.String("repurl", "https://chromium.googlesource.com/chromiumos/platform/tast-tests/", "repo url")
-	branch := flag.String("branch", "main", "branch name")
-	timeout := flag.Int("timeout", 5, "timeout in seconds")
-	cmtsPath := flag.String("cmtspath", "", "path to commit files directory")
-	outpath := flag.String("outpath", "out.csv", "path to output file")
+	reposPath := flag.String("repos", "", "path to a file listing repo urls, one per line, to scrape instead of repurl and count together")
+	parallelRepos := flag.Int("parallel-repos", 1, "number of the repos listed in repos scraped at once, each in a tab of its own")
+	allowedHosts := flag.String("allowed-hosts", "*.googlesource.com,github.com", "comma separated hosts repurl may be on, *. matching any subdomain")
+	allowAnyHost := flag.Bool("allow-any-host", false, "accept a repurl on any host")
+	branch := flag.String("branch", "main", "branch name, or a tag as refs/tags/<name> or a full commit hash to start from")
+	timeout := flag.Int("timeout", 5, "timeout of the whole run in seconds")
+	commitTimeout := flag.Int("commit-timeout", 0, "seconds each commit may take, bounding the run by cnumber times it unless timeout is given and shorter, 0 for none")
+	pageTimeout := flag.Int("page-timeout", 0, "timeout of loading a single page in seconds, 0 for none")
+	cmtsPath := flag.String("cmtspath", "", "directory to write commit messages to, none are written if empty")
+	gzipCommits := flag.Bool("gzip-commits", false, "gzip the files written to cmtspath")
+	stripTrailersFlag := flag.Bool("strip-trailers", false, "leave the trailers, like Reviewed-by and Change-Id, out of the messages written to cmtspath")
+	maxCommitBytes := flag.Int("max-commit-bytes", 0, "most bytes of a message to write to its commit file, 0 for no limit")
+	outpath := flag.String("outpath", "out.csv", "path to output file, - for stdout, gzipped if it ends in .gz")
+	appendOut := flag.Bool("append", false, "add the counts to those already in outpath instead of overwriting it")
+	dbPath := flag.String("db", "", "path to a sqlite database to write the contributors and commits to, none if empty")
+	commitsOut := flag.String("commits-out", "", "path to write a csv with a row for each commit scraped to, the latest first, none if empty")
+	stream := flag.Bool("stream", false, "write each commit to db and commits-out as soon as it's counted instead of holding them all until the end, commits-out is then in the order of the walk")
+	timeseriesOut := flag.String("timeseries-out", "", "path to write a csv of what each contributor created and reviewed month by month to, none if empty")
+	bugsOut := flag.String("bugs-out", "", "path to write a csv of the number of commits referencing each bug to, none if empty")
+	format := flag.String("format", "csv", "output format: csv, tsv, json, html, md, prom, or jsonl for a line per commit written as it's scraped")
+	devtools := flag.String("devtools", "http://127.0.0.1:9222", "devtools endpoint of the browser")
+	userAgent := flag.String("user-agent", "", "user agent to load pages with, the browser's own if empty")
+	var cookies, headers repeated
+	flag.Var(&cookies, "cookie", "name=value of a cookie to send to the host of repurl, may be repeated")
+	flag.Var(&headers, "header", "\"Name: value\" of a header to send with every request, like an Authorization, may be repeated")
+	launch := flag.Bool("launch", false, "launch a headless chrome instead of using a running one")
+	scopePath := flag.String("path", "", "walk only the history of this path of the repo, as its log lists it")
+	includePath := flag.String("include-path", "", "only count commits changing files under this path of the repo")
+	commitPages := flag.Bool("commit-pages", false, "read every commit from its page rather than from the log, for the diffstat and the files changed")
+	checkpointPath := flag.String("checkpoint", "", "file to save the state of the walk to and resume it from in a later run, none if empty")
+	checkpointEvery := flag.Int("checkpoint-every", 100, "number of commits counted between checkpoints")
+	restart := flag.Bool("restart", false, "start at the tip of the branch even if there's a checkpoint to resume from")
+	untilCommit := flag.String("until-commit", "", "stop when reaching this (possibly abbreviated) commit hash")
+	screenshotDir := flag.String("screenshot-dir", "", "directory to save screenshots of commit pages to, none are taken if empty")
+	htmlDir := flag.String("html-dir", "", "directory of saved pages to read instead of driving a browser")
+	cacheDir := flag.String("cache-dir", "", "directory to cache fetched pages in")
+	refresh := flag.Bool("refresh", false, "refetch pages even if they are cached")
+	retries := flag.Int("retries", 3, "times to retry a page that failed to load")
+	waitFor := flag.String("wait-for", "domcontent", "event taking a page for loaded: domcontent, load or networkidle")
+	waitSelector := flag.String("wait-selector", "pre", "css selector of an element to wait for in loaded pages, none if empty")
+	waitTimeout := flag.Int("wait-timeout", 2, "seconds to wait for wait-selector before taking a page as it is")
+	concurrency := flag.Int("concurrency", 1, "number of commit pages to load at once, each in its own tab")
+	rate := flag.Float64("rate", 0, "most pages to load per second, 0 for no limit")
+	sinceStr := flag.String("since", "", "only count commits authored at or after this date (RFC3339 or YYYY-MM-DD)")
+	untilStr := flag.String("until", "", "only count commits authored at or before this date (RFC3339 or YYYY-MM-DD)")
+	resolveNames := flag.Bool("resolve-names", false, "count people named without an email under the contributor with an email going by that name")
+	aliasesPath := flag.String("aliases", "", "path to a json file mapping canonical emails to lists of their aliases")
+	excludeBots := flag.Bool("exclude-bots", false, "don't count bot accounts")
+	botPatterns := flag.String("bots", strings.Join(contrib.DefaultBots, ","), "comma separated globs of the emails or names of bots for exclude-bots")
+	skipErrors := flag.Bool("skip-errors", false, "skip commits that can't be parsed instead of failing")
+	source := flag.String("source", "", "kind of site repurl is on: gitiles or github, guessed from its host if empty")
+	weightsStr := flag.String("weights", "", "score weights of the count columns, like created=2,reviewed=1")
+	only := flag.String("only", "", "comma separated names or emails, only contributors whose name or email contains one are written")
+	top := flag.Int("top", 0, "most contributors to write, the first in sort order, 0 for all")
+	summary := flag.Bool("summary", false, "print totals to stderr and add a TOTAL row to the output")
+	reviewerKeys := flag.String("reviewer-keys", "", "comma separated trailer keys to read reviewers from besides Reviewed-by, like R=")
+	trailerBucketsStr := flag.String("trailer-buckets", "", "comma separated bucket=key pairs counting who trailers name in buckets output as columns, like acked=Acked-by:")
+	noSelfReview := flag.Bool("no-self-review", false, "don't count the reviews authors gave their own commits")
+	splitCredit := flag.Bool("split-credit", false, "split the created credit of a commit between its author and co-authors")
+	sortOrder := flag.String("sort", "score", "order of the output rows: score or name")
+	commitFormat := flag.String("commit-format", "text", "format of the commit files: text for the message or json for all the commit's data")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn or error")
+	dryRun := flag.Bool("dry-run", false, "only print the commit the walk starts at and the parent it'd follow, writing nothing")
+	quiet := flag.Bool("quiet", false, "don't report progress on stderr")
+	backend := flag.String("backend", "cdp", "where to read commits from: cdp to scrape pages in a browser or gerrit to query its REST api")
+	gerritURL := flag.String("gerrit-url", "", "gerrit instance of the gerrit backend, derived from repurl if empty")
+	configPath := flag.String("config", "", "path to a yaml file of flag values, overridden by the flags given")
 	flag.Parse()
+	if *configPath != "" {
+		if err := loadConfig(*configPath); err != nil {
+			fatal("can't load config: ", err)
+		}
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		fatal("invalid log-level: ", err)
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
 
 	if *timeout <= 0 {
-		log.Fatal("invalid timeout parameter")
+		fatal("invalid timeout parameter")
+	}
+	if *commitTimeout < 0 {
+		fatal("invalid commit-timeout parameter")
+	}
+	if *pageTimeout < 0 {
+		fatal("invalid page-timeout parameter")
 	}
 	if *branch == "" {
-		log.Fatal("empty branch is invalid")
+		fatal("empty branch is invalid")
 	}
 	if *repurl == "" {
-		log.Fatal("empty url is invalid")
+		fatal("empty url is invalid")
+	}
+	if err := checkRepoURL(*repurl, strings.Split(*allowedHosts, ","), *allowAnyHost); err != nil {
+		fatal(err)
+	}
+	var repos []string
+	if *reposPath != "" {
+		var err error
+		if repos, err = loadRepos(*reposPath); err != nil {
+			fatal("can't load repos: ", err)
+		}
+		if len(repos) == 0 {
+			fatal("no repos in ", *reposPath)
+		}
+		for _, r := range repos {
+			if err = checkRepoURL(r, strings.Split(*allowedHosts, ","), *allowAnyHost); err != nil {
+				fatal(err)
+			}
+		}
+	}
+	if *parallelRepos < 1 {
+		fatal("invalid parallel-repos")
 	}
 	if *cnumber <= 0 {
-		log.Fatal("invalid cnumber")
+		fatal("invalid cnumber")
 	}
 	if *outpath == "" {
-		log.Fatal("output path can't be empty")
+		fatal("output path can't be empty")
 	}
-
-	err := run(time.Duration(*timeout)*time.Second, *cmtsPath, *repurl, *branch, *outpath, *cnumber)
+	if !contrib.HasOutputFormat(*format) {
+		fatal("unknown output format")
+	}
+	if *top < 0 {
+		fatal("invalid top")
+	}
+	if *appendOut && *outpath == "-" {
+		fatal("can't append to stdout")
+	}
+	if *appendOut && !contrib.CanAppend(*format) {
+		fatal(fmt.Sprintf("can't append to %s output", *format))
+	}
+	if !contrib.HasCommitFormat(*commitFormat) {
+		fatal("unknown commit format")
+	}
+	if *maxCommitBytes < 0 {
+		fatal("invalid max-commit-bytes")
+	}
+	if !contrib.HasSortOrder(*sortOrder) {
+		fatal("unknown sort order")
+	}
+	if !contrib.HasWaitFor(*waitFor) {
+		fatal("unknown wait-for event")
+	}
+	if !contrib.HasBackend(*backend) {
+		fatal("unknown backend")
+	}
+	if *checkpointPath != "" && *backend == "gerrit" {
+		fatal("the gerrit backend can't resume from checkpoints")
+	}
+	if *backend == "gerrit" && !contrib.IsBranchName(*branch) {
+		fatal("the gerrit backend can only query branches")
+	}
+	if *checkpointPath != "" && len(repos) > 0 {
+		fatal("checkpoints can't be combined with repos")
+	}
+	// checkpoints keep the counts only, the rest would be lost on resuming
+	if *checkpointPath != "" && (*bugsOut != "" || *timeseriesOut != "" || *commitsOut != "" || *dbPath != "") {
+		fatal("checkpoints can't be combined with bugs-out, timeseries-out, commits-out or db")
+	}
+	if *dryRun && len(repos) > 0 {
+		fatal("dry-run checks a single repurl, not repos")
+	}
+	if *checkpointEvery < 1 {
+		fatal("invalid checkpoint-every")
+	}
+	if *gerritURL != "" {
+		if u, err := url.Parse(*gerritURL); err != nil || u.Scheme == "" || u.Host == "" {
+			fatal(fmt.Sprintf("invalid gerrit url %q", *gerritURL))
+		}
+	}
+	if u, err := url.Parse(*devtools); err != nil || u.Scheme == "" || u.Host == "" {
+		fatal(fmt.Sprintf("invalid devtools url %q", *devtools))
+	}
+	if *retries < 0 {
+		fatal("invalid retries")
+	}
+	if *waitTimeout < 0 {
+		fatal("invalid wait-timeout")
+	}
+	if *concurrency < 1 {
+		fatal("invalid concurrency")
+	}
+	if *rate < 0 {
+		fatal("invalid rate")
+	}
+	since, err := parseDateFlag(*sinceStr, false)
 	if err != nil {
-		log.Fatal(err)
+		fatal("invalid since: ", err)
 	}
-}
-
-type Contribution struct {
-	Reviewed, Created int
-}
-
-func run(timeout time.Duration, cmtsPath, repurl, branch, outpath string, cnumber int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	devt := devtool.New("http://127.0.0.1:9222")
-	pt, err := devt.Get(ctx, devtool.Page)
+	until, err := parseDateFlag(*untilStr, true)
 	if err != nil {
-		pt, err = devt.Create(ctx)
+		fatal("invalid until: ", err)
+	}
+	if !since.IsZero() && !until.IsZero() && until.Before(since) {
+		fatal("until is before since")
+	}
+	if !since.IsZero() && *backend == "gerrit" {
+		fatal("the gerrit backend can't stop at a since date")
+	}
+	trailerBuckets, err := contrib.ParseTrailerBuckets(splitList(*trailerBucketsStr))
+	if err != nil {
+		fatal("invalid trailer buckets: ", err)
+	}
+	bucketNames := make([]string, 0, len(trailerBuckets))
+	for _, b := range trailerBuckets {
+		bucketNames = append(bucketNames, b)
+	}
+	weights, err := contrib.ParseWeights(*weightsStr, bucketNames...)
+	if err != nil {
+		fatal("invalid weights: ", err)
+	}
+	src, err := contrib.SourceFor(*source, *repurl)
+	if err != nil {
+		fatal(err)
+	}
+	var aliases map[string]string
+	if *aliasesPath != "" {
+		aliases, err = contrib.LoadAliases(*aliasesPath)
 		if err != nil {
-			return err
+			fatal("can't load aliases: ", err)
 		}
 	}
-
-	conn, err := rpcc.DialContext(ctx, pt.WebSocketDebuggerURL)
+	cookieMap, err := parsePairs(cookies, "=")
 	if err != nil {
-		return err
+		fatal("invalid cookie: ", err)
+	}
+	headerMap, err := parsePairs(headers, ":")
+	if err != nil {
+		fatal("invalid header: ", err)
+	}
+	var bots []string
+	if *excludeBots {
+		bots = splitList(*botPatterns)
+	}
+	if (*untilCommit != "" || !since.IsZero()) && !isFlagSet("cnumber") {
+		// walk until the stop condition is met, however far it is
+		*cnumber = 0
+	}
+
+	opts := contrib.Options{
+		Backend:         *backend,
+		GerritURL:       *gerritURL,
+		HTMLDir:         *htmlDir,
+		DevTools:        *devtools,
+		UserAgent:       *userAgent,
+		Cookies:         cookieMap,
+		Headers:         headerMap,
+		Launch:          *launch,
+		RepoURL:         *repurl,
+		Branch:          *branch,
+		Source:          src,
+		Count:           *cnumber,
+		UntilCommit:     *untilCommit,
+		Since:           since,
+		Until:           until,
+		Path:            *scopePath,
+		IncludePath:     *includePath,
+		CommitPages:     *commitPages,
+		Checkpoint:      *checkpointPath,
+		CheckpointEvery: *checkpointEvery,
+		Restart:         *restart,
+		CommitsPath:     *cmtsPath,
+		CommitFormat:    *commitFormat,
+		GzipCommits:     *gzipCommits,
+		StripTrailers:   *stripTrailersFlag,
+		MaxCommitBytes:  *maxCommitBytes,
+		ScreenshotDir:   *screenshotDir,
+		CacheDir:        *cacheDir,
+		Refresh:         *refresh,
+		Retries:         *retries,
+		CommitTimeout:   time.Duration(*commitTimeout) * time.Second,
+		PageTimeout:     time.Duration(*pageTimeout) * time.Second,
+		WaitFor:         *waitFor,
+		WaitSelector:    *waitSelector,
+		WaitTimeout:     time.Duration(*waitTimeout) * time.Second,
+		Concurrency:     *concurrency,
+		Rate:            *rate,
+		ReviewerKeys:    splitList(*reviewerKeys),
+		TrailerBuckets:  trailerBuckets,
+		NoSelfReview:    *noSelfReview,
+		SplitCredit:     *splitCredit,
+		SkipErrors:      *skipErrors,
+		ResolveNames:    *resolveNames,
+		Aliases:         aliases,
+		Bots:            bots,
+	}
+
+	var prog *progress
+	if !*quiet {
+		prog = newProgress(os.Stderr)
+		opts.Progress = prog.update
+	}
+
+	outOpts := contrib.OutputOptions{
+		Format:  *format,
+		Weights: weights,
+		Sort:    *sortOrder,
+		Summary: *summary,
+		Append:  *appendOut,
+		Only:    splitList(*only),
+		Top:     *top,
+	}
+
+	if !*dryRun {
+		// fail now rather than after scraping everything
+		for _, f := range []string{*outpath, *bugsOut, *dbPath, *commitsOut, *timeseriesOut, *checkpointPath} {
+			if f == "" || f == "-" {
+				continue
+			}
+			if err = checkWritableDir(filepath.Dir(f)); err != nil {
+				fatal("can't write ", f, ": ", err)
+			}
+		}
+		if *cmtsPath != "" {
+			if err = checkWritableDir(*cmtsPath); err != nil {
+				fatal("can't write commits to ", *cmtsPath, ": ", err)
+			}
+		}
 	}
-	defer conn.Close()
 
-	c := cdp.NewClient(conn)
+	if len(repos) > 0 && *source == "" {
+		// guessed for each repo instead
+		opts.Source = nil
+	}
 
-	domContent, err := c.Page.DOMContentEventFired(ctx)
+	// repos beyond parallel wait for a turn, taking the time of theirs
+	rounds := 1
+	if len(repos) > 0 {
+		rounds = (len(repos) + *parallelRepos - 1) / *parallelRepos
+	}
+	budget := runTimeout(time.Duration(*timeout)*time.Second, isFlagSet("timeout"), opts.CommitTimeout, *cnumber*rounds)
+	if *dryRun {
+		err = dryRunScrape(budget, opts)
+	} else {
+		out := outputs{path: *outpath, opts: outOpts, bugs: *bugsOut, db: *dbPath, commits: *commitsOut,
+			timeseries: *timeseriesOut, stream: *stream}
+		err = run(budget, opts, repos, *parallelRepos, prog, out)
+	}
 	if err != nil {
-		return err
+		fatal(err)
+	}
+}
+
+// outputs are the files a run writes.
+type outputs struct {
+	// path is the contributions output, written as opts say.
+	path string
+	opts contrib.OutputOptions
+	// bugs, db, commits and timeseries, if set, are where the per-bug
+	// counts, the sqlite database, the per-commit rows and the monthly counts
+	// go.
+	bugs       string
+	db         string
+	commits    string
+	timeseries string
+	// stream writes db and commits a commit at a time.
+	stream bool
+}
+
+// runTimeout returns how long a run of count commits may take. With a budget
+// per commit it's count times that, still capped by timeout if it was asked
+// for explicitly. Without one, or with no count to multiply, it's timeout.
+func runTimeout(timeout time.Duration, explicit bool, perCommit time.Duration, count int) time.Duration {
+	if perCommit <= 0 || count <= 0 {
+		return timeout
+	}
+	t := time.Duration(count) * perCommit
+	if explicit && timeout < t {
+		return timeout
 	}
-	defer domContent.Close()
+	return t
+}
 
-	if err = c.Page.Enable(ctx); err != nil {
-		return err
+// runContext returns the context of a run, done after timeout or once
+// interrupted.
+func runContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	sctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithTimeout(sctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
 	}
+}
 
-	m, err := fetchLink(c, ctx, domContent, repurl)
-	if err != nil {
-		return err
+// run scrapes the repo of opts, or repos if any, parallel of them at a time,
+// and writes out what it found.
+func run(timeout time.Duration, opts contrib.Options, repos []string, parallel int, prog *progress, out outputs) error {
+	ctx, cancel := runContext(timeout)
+	defer cancel()
+
+	// the same repo always makes the same links, slash or not
+	opts.RepoURL = strings.TrimRight(opts.RepoURL, "/")
+	for i := range repos {
+		repos[i] = strings.TrimRight(repos[i], "/")
 	}
 
-	link, err := getMainLink(m, branch)
+	// a resumed walk goes on from the commits counted before
+	resumed, resuming, err := contrib.CheckpointCounted(opts)
 	if err != nil {
 		return err
 	}
 
-	conts := make(map[string]Contribution)
-
-	for i := 0; i < cnumber; i++ {
-		// fetch commit page
-		p, err := fetchLink(c, ctx, domContent, link)
-		if err != nil {
+	bugs := make(map[string]int)
+	var cmts []contrib.CommitRecord
+	var commitLog *contrib.CommitLog
+	if contrib.IsStreamFormat(out.opts.Format) {
+		// keeping the lines the walk resumed from wrote
+		if commitLog, err = contrib.OpenCommitLog(out.path, out.opts.Append || resuming); err != nil {
 			return err
 		}
-
-		// get commit
-		cmt, err := getCommitHash(p)
-		if err != nil {
-			return err
+		defer commitLog.Close()
+	}
+	// with stream, the commits go to the database and the commits csv as
+	// they're counted instead of being held until the end
+	var db *contrib.DB
+	var commitsCSV *contrib.CommitLog
+	var dbErr error
+	if out.stream {
+		if out.db != "" {
+			if db, err = contrib.OpenDB(out.db); err != nil {
+				return err
+			}
+			defer db.Close()
 		}
-
-		// get next link
-		link, err = getParentCommitLink(p, repurl)
-		if err != nil {
-			return err
+		if out.commits != "" {
+			if commitsCSV, err = contrib.OpenCommitsCSV(out.commits, len(repos) > 0); err != nil {
+				return err
+			}
+			defer commitsCSV.Close()
 		}
-
-		// get commit message
-		msg, err := getCommitMessage(p)
-		if err != nil {
-			return err
+	}
+	var series *contrib.TimeSeries
+	if out.timeseries != "" {
+		series = contrib.NewTimeSeries(opts)
+	}
+	counted := resumed
+	opts.Commit = func(cmt contrib.CommitRecord) {
+		counted++
+		if series != nil {
+			series.Add(cmt)
 		}
-
-		// get author
-		author, err := getAuthor(p)
-		if err != nil {
-			return err
+		if commitLog != nil {
+			commitLog.Write(cmt)
 		}
-		if i, v := conts[author]; !v {
-			conts[author] = Contribution{Created: 1, Reviewed: 0}
-		} else {
-			i.Created++
+		if commitsCSV != nil {
+			commitsCSV.Write(cmt)
 		}
-
-		// get reviewers
-		reviewers, err := getReviewers(msg)
-		if err != nil {
-			return err
+		if db != nil && dbErr == nil {
+			dbErr = db.WriteCommit(cmt)
 		}
-		for _, rev := range reviewers {
-			if i, v := conts[rev]; !v {
-				conts[rev] = Contribution{Created: 0, Reviewed: 1}
-			} else {
-				i.Created++
-			}
+		for _, b := range cmt.Bugs {
+			bugs[b]++
 		}
-
-		// write commit message
-		err = ioutil.WriteFile(cmtsPath+cmt+".commit", []byte(msg), 0644)
-		if err != nil {
-			return err
+		if !out.stream && (out.db != "" || out.commits != "") {
+			cmts = append(cmts, cmt)
 		}
 	}
 
-	err = ioutil.WriteFile(outpath, []byte(buildCSVString(conts)), 0644)
-	if err != nil {
+	var conts map[string]contrib.Contribution
+	if len(repos) > 0 {
+		conts, err = contrib.ScrapeRepos(ctx, opts, repos, parallel)
+	} else {
+		conts, err = contrib.Scrape(ctx, opts)
+	}
+	prog.finish()
+	if err != nil && !errors.Is(err, contrib.ErrIncomplete) {
 		return err
 	}
 
-	return nil
-}
-
-func fetchLink(c *cdp.Client, ctx context.Context, domContent page.DOMContentEventFiredClient, url string) (string, error) {
-	navArgs := page.NewNavigateArgs(url)
-	_, err := c.Page.Navigate(ctx, navArgs)
-	if err != nil {
-		return "", err
+	// write whatever was gathered, even if the scrape was cut short
+	out.opts.Commits = counted
+	if commitLog != nil {
+		if werr := commitLog.Close(); werr != nil {
+			return werr
+		}
+	} else if werr := contrib.WriteOutput(conts, out.path, out.opts); werr != nil {
+		return werr
 	}
-
-	if _, err = domContent.Recv(); err != nil {
-		return "", err
+	if out.bugs != "" {
+		if werr := contrib.WriteBugs(bugs, out.bugs); werr != nil {
+			return werr
+		}
 	}
-
-	doc, err := c.DOM.GetDocument(ctx, nil)
-	if err != nil {
-		return "", err
+	if commitsCSV != nil {
+		if werr := commitsCSV.Close(); werr != nil {
+			return werr
+		}
+	} else if out.commits != "" {
+		if werr := contrib.WriteCommits(cmts, out.commits); werr != nil {
+			return werr
+		}
 	}
-
-	result, err := c.DOM.GetOuterHTML(ctx, &dom.GetOuterHTMLArgs{
-		NodeID: &doc.Root.NodeID,
-	})
-	if err != nil {
-		return "", err
+	if series != nil {
+		if werr := series.Write(out.timeseries); werr != nil {
+			return werr
+		}
 	}
-	return result.OuterHTML, nil
-}
-
-func getMainLink(r, branch string) (string, error) {
-	doc, err := html.Parse(strings.NewReader(r))
-	if err != nil {
-		return "", err
-	}
-	var f func(*html.Node) (string, error)
-	f = func(n *html.Node) (string, error) {
-		if n.Type == html.ElementNode && n.Data == "a" {
-			for _, atr := range n.Attr {
-				if atr.Key == "href" && strings.Contains(atr.Val, "/"+branch) {
-					return atr.Val, nil
-				}
-			}
+	if db != nil {
+		if dbErr != nil {
+			return dbErr
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			l, err := f(c)
-			if err == nil {
-				return l, nil
-			}
+		if werr := db.WriteContributions(conts); werr != nil {
+			return werr
 		}
-		return "", fmt.Errorf("can't find link!")
+	} else if out.db != "" {
+		if werr := contrib.WriteDB(out.db, conts, cmts); werr != nil {
+			return werr
+		}
+	}
+	s := contrib.Summarize(conts, counted)
+	slog.Info("scrape done", "contributors", s.Contributors, "commits", s.Commits, "reviews", s.Reviews)
+	if out.opts.Summary {
+		fmt.Fprintf(os.Stderr, "%d contributors, %d commits, %d reviews\n", s.Contributors, s.Commits, s.Reviews)
 	}
-	s, err := f(doc)
 	if err != nil {
-		return "", err
+		fmt.Fprintf(os.Stderr, "stopped early, wrote the %d commits scraped until then\n", counted)
 	}
-	return "https://chromium.googlesource.com" + s, nil
+	return err
 }
 
-func getCommitHash(r string) (string, error) {
-	doc, err := html.Parse(strings.NewReader(r))
-	if err != nil {
-		return "", err
+// dryRunScrape reads the first commit opts selects and prints it, without
+// walking further or writing any file.
+func dryRunScrape(timeout time.Duration, opts contrib.Options) error {
+	ctx, cancel := runContext(timeout)
+	defer cancel()
+
+	opts.RepoURL = strings.TrimRight(opts.RepoURL, "/")
+	opts.Count = 1
+	opts.CommitsPath, opts.CacheDir, opts.ScreenshotDir, opts.Checkpoint = "", "", "", ""
+	opts.Progress = nil
+	found := false
+	opts.Commit = func(cmt contrib.CommitRecord) {
+		found = true
+		fmt.Printf("commit %s\nauthor %s\nparents %s\n", cmt.Hash, cmt.Author, strings.Join(cmt.Parents, " "))
 	}
-	var f func(*html.Node) (string, error)
-	f = func(n *html.Node) (string, error) {
-		if n.Type == html.TextNode {
-			if n.Data == "commit" {
-				return n.Parent.NextSibling.FirstChild.Data, nil
-			}
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			l, err := f(c)
-			if err == nil {
-				return l, nil
-			}
-		}
-		return "", fmt.Errorf("can't find commit!")
+
+	if _, err := contrib.Scrape(ctx, opts); err != nil {
+		return err
 	}
-	s, err := f(doc)
-	if err != nil {
-		return "", err
+	if !found {
+		return errors.New("no commit to start at")
 	}
-	return s, nil
+	return nil
 }
 
-func getAuthor(r string) (string, error) {
-	doc, err := html.Parse(strings.NewReader(r))
+// loadRepos reads the repo urls listed in the file at path, one per line.
+// Blank lines and those starting with # are skipped.
+func loadRepos(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	var f func(*html.Node) (string, error)
-	f = func(n *html.Node) (string, error) {
-		if n.Type == html.TextNode {
-			if n.Data == "author" {
-				return n.Parent.NextSibling.FirstChild.Data, nil
-			}
+	var repos []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			repos = append(repos, line)
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			l, err := f(c)
-			if err == nil {
-				return l, nil
-			}
-		}
-		return "", fmt.Errorf("can't find author!")
 	}
-	s, err := f(doc)
-	if err != nil {
-		return "", err
-	}
-	return s, nil
+	return repos, nil
 }
 
-func getCommitMessage(r string) (string, error) {
-	doc, err := html.Parse(strings.NewReader(r))
-	if err != nil {
-		return "", err
-	}
-	var f2 func(*html.Node) (string, error)
-	f2 = func(n *html.Node) (string, error) {
-		if n.Type == html.TextNode {
-			return n.Data, nil
-		}
-		total := ""
-		m := 0
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			l, err := f2(c)
-			if err == nil {
-				total += l
-				m++
-			}
-		}
-		if m == 0 {
-			return "", fmt.Errorf("can't find text!")
+// fatal logs v as an error, whatever the log level, and exits non-zero.
+func fatal(v ...any) {
+	slog.Error(fmt.Sprint(v...))
+	os.Exit(1)
+}
+
+// repeated is a flag that may be given several times, collecting the values
+// in order.
+type repeated []string
+
+func (r *repeated) String() string { return strings.Join(*r, ", ") }
+
+func (r *repeated) Set(s string) error {
+	*r = append(*r, s)
+	return nil
+}
+
+// parsePairs splits each of l at the first sep into a key and a value, both
+// trimmed of surrounding space.
+func parsePairs(l []string, sep string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, s := range l {
+		k, v, ok := strings.Cut(s, sep)
+		if k = strings.TrimSpace(k); !ok || k == "" {
+			return nil, fmt.Errorf("%q isn't key%svalue", s, sep)
 		}
-		return total, nil
+		m[k] = strings.TrimSpace(v)
 	}
-	var f func(*html.Node) (string, error)
-	f = func(n *html.Node) (string, error) {
-		if n.Type == html.ElementNode && n.Data == "pre" {
-			return f2(n)
+	return m, nil
+}
+
+// splitList splits a comma separated flag, dropping empty elements.
+func splitList(s string) []string {
+	var l []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			l, err := f(c)
-			if err == nil {
-				return l, nil
-			}
+	}
+	return l
+}
+
+// checkRepoURL checks that s is an absolute http(s) url on one of hosts,
+// where "*.example.com" stands for any subdomain of example.com. With anyHost
+// the host isn't checked.
+func checkRepoURL(s string, hosts []string, anyHost bool) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid repo url %q", s)
+	}
+	if anyHost {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range hosts {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h == host || (strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:])) {
+			return nil
 		}
-		return "", fmt.Errorf("can't find commit!")
 	}
-	s, err := f(doc)
+	return fmt.Errorf("repo url host %q isn't one of %s, pass --allow-any-host to use it anyway", host, strings.Join(hosts, ", "))
+}
+
+// checkWritableDir creates dir if missing and checks files can be created in
+// it.
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".write-check-*")
 	if err != nil {
-		return "", err
+		return err
 	}
-	return s, nil
+	f.Close()
+	return os.Remove(f.Name())
 }
 
-func getParentCommitLink(r, repurl string) (string, error) {
-	doc, err := html.Parse(strings.NewReader(r))
-	if err != nil {
-		return "", err
+// parseDateFlag parses an RFC3339 time or a YYYY-MM-DD date. Dates stand for
+// the start of the day, or its last instant when endOfDay is set, so that
+// ranges built from them are inclusive.
+func parseDateFlag(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
 	}
-	var f func(*html.Node) (string, error)
-	f = func(n *html.Node) (string, error) {
-		if n.Type == html.TextNode {
-			if n.Data == "parent" {
-				return n.Parent.NextSibling.FirstChild.FirstChild.Data, nil
-			}
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			l, err := f(c)
-			if err == nil {
-				return l, nil
-			}
-		}
-		return "", fmt.Errorf("can't find commit!")
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
 	}
-	s, err := f(doc)
+	t, err := time.Parse("2006-01-02", s)
 	if err != nil {
-		return "", err
+		return time.Time{}, fmt.Errorf("%q is neither RFC3339 nor YYYY-MM-DD", s)
 	}
-	return repurl + "/+/" + s, nil
-}
-
-func getReviewers(msg string) ([]string, error) {
-	lines := strings.Split(msg, "\n")
-	revs := make([]string, 0)
-	for _, line := range lines {
-		if strings.Contains(line, "Reviewed-by: ") && strings.Index(line, "Reviewed-by: ") == 0 {
-			revs = append(revs, line[13:])
-		}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
 	}
-	return revs, nil
+	return t, nil
 }
 
-func buildCSVString(conts map[string]Contribution) string {
-	s := "contributor,created,reviewed"
-	for k, v := range conts {
-		s += "\n" + k + "," + strconv.Itoa(v.Created) + "," + strconv.Itoa(v.Reviewed)
-	}
-	return s
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mido3ds/gsoc-chromium-starter/contrib"
+)
+
+const testRepo = "https://chromium.googlesource.com/chromiumos/platform/tast-tests"
+
+// savedRepo returns the options scraping the saved pages of testdata/gitiles.
+func savedRepo() contrib.Options {
+	return contrib.Options{HTMLDir: filepath.Join("testdata", "gitiles"), RepoURL: testRepo, Branch: "main",
+		Source: contrib.Gitiles, Count: 100}
+}
+
+func writeTestFile(t testing.TB, path, data string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// captureStdout returns what f writes to stdout.
+func captureStdout(t testing.TB, f func()) string {
+	t.Helper()
+	return capture(t, &os.Stdout, f)
+}
+
+// capture returns what f writes to the file *std, like stdout.
+func capture(t testing.TB, std **os.File, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := *std
+	*std = w
+	defer func() { *std = prev }()
+	out := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		out <- b
+	}()
+	f()
+	w.Close()
+	return string(<-out)
+}
+
+func TestParseDateFlag(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		endOfDay bool
+		want     time.Time
+		wantErr  bool
+	}{
+		{"", false, time.Time{}, false},
+		{"2021-02-28", false, time.Date(2021, 2, 28, 0, 0, 0, 0, time.UTC), false},
+		{"2021-02-28", true, time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond), false},
+		{"2021-02-28T10:00:00+09:00", true, time.Date(2021, 2, 28, 1, 0, 0, 0, time.UTC), false},
+		{"28/02/2021", false, time.Time{}, true},
+	} {
+		got, err := parseDateFlag(tc.s, tc.endOfDay)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseDateFlag(%q, %v) err = %v, want error %v", tc.s, tc.endOfDay, err, tc.wantErr)
+			continue
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("parseDateFlag(%q, %v) = %v, want %v", tc.s, tc.endOfDay, got, tc.want)
+		}
+	}
+}
+
+func TestCheckRepoURL(t *testing.T) {
+	hosts := []string{"*.googlesource.com", "github.com"}
+	for _, tc := range []struct {
+		url     string
+		anyHost bool
+		ok      bool
+	}{
+		{"https://chromium.googlesource.com/chromiumos/platform/tast-tests", false, true},
+		{"https://Chromium.GoogleSource.com/chromium/src", false, true},
+		{"http://android.googlesource.com/platform/build", false, true},
+		{"https://github.com/octo-org/widgets", false, true},
+		{"https://chromium.googlesource.com:443/chromium/src", false, true},
+		{"https://gitlab.com/octo-org/widgets", false, false},
+		{"https://notgooglesource.com/chromium/src", false, false},
+		{"https://googlesource.com.evil.com/chromium/src", false, false},
+		{"https://gitlab.com/octo-org/widgets", true, true},
+		// not urls, even with any host
+		{"chromium.googlesource.com/chromium/src", true, false},
+		{"ftp://chromium.googlesource.com/chromium/src", true, false},
+		{"https:///chromium/src", true, false},
+		{"", true, false},
+	} {
+		err := checkRepoURL(tc.url, hosts, tc.anyHost)
+		if (err == nil) != tc.ok {
+			t.Errorf("checkRepoURL(%q, anyHost %v) = %v, want ok %v", tc.url, tc.anyHost, err, tc.ok)
+		}
+	}
+}
+
+func TestDryRunWritesNothing(t *testing.T) {
+	dir := t.TempDir()
+	opts := savedRepo()
+	opts.CommitsPath = filepath.Join(dir, "commits")
+	opts.CacheDir = filepath.Join(dir, "cache")
+	opts.ScreenshotDir = filepath.Join(dir, "shots")
+	opts.Checkpoint = filepath.Join(dir, "checkpoint.json")
+
+	out := captureStdout(t, func() {
+		if err := dryRunScrape(time.Minute, opts); err != nil {
+			t.Errorf("dryRunScrape: %v", err)
+		}
+	})
+	want := "commit 5d1e7c0a9f3b42e6a8c1d0f7b2e9a4c6d3f8b1e0\nauthor Jane Doe <jdoe@chromium.org>\n" +
+		"parents 8a2f4c6e1b3d5f7a9c0e2b4d6f8a1c3e5b7d9f0a\n"
+	if out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		t.Errorf("dry run wrote %s", f.Name())
+	}
+}
+
+func TestRunInterruptedWritesPartialOutput(t *testing.T) {
+	dir := t.TempDir()
+	out := outputs{path: filepath.Join(dir, "out.csv"), opts: contrib.OutputOptions{Format: "csv", Sort: "name"}}
+	opts := savedRepo()
+	// the test sees the interrupt too, so it knows when it has arrived
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	defer signal.Stop(interrupted)
+	done := 0
+	opts.Progress = func(n, total int) {
+		done = n
+		if n == 2 {
+			if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+				t.Fatal(err)
+			}
+			<-interrupted
+			// let the run's context see it too
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+
+	var err error
+	stderr := capture(t, &os.Stderr, func() {
+		err = run(time.Minute, opts, nil, 1, nil, out)
+	})
+	if !errors.Is(err, contrib.ErrIncomplete) {
+		t.Fatalf("run = %v, want it cut short", err)
+	}
+	if done != 2 {
+		t.Errorf("scraped %d commits, want to stop after the 2 before the interrupt", done)
+	}
+	if want := "wrote the 2 commits scraped"; !strings.Contains(stderr, want) {
+		t.Errorf("printed %q, want it to tell %q", stderr, want)
+	}
+
+	f, err := os.Open(out.path)
+	if err != nil {
+		t.Fatalf("no partial output: %v", err)
+	}
+	defer f.Close()
+	recs, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := 0.0
+	for _, rec := range recs[1:] {
+		n, err := strconv.ParseFloat(rec[2], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		created += n
+	}
+	if created != 2 {
+		t.Errorf("the output counts %v commits created, want 2: %q", created, recs)
+	}
+}
+
+func TestRunWritesCommitsScraped(t *testing.T) {
+	// only jdoe is written, who created 2 of the 6 commits
+	out := outputs{path: filepath.Join(t.TempDir(), "out.prom"),
+		opts: contrib.OutputOptions{Format: "prom", Only: []string{"jdoe"}}}
+	if err := run(time.Minute, savedRepo(), nil, 1, nil, out); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(out.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\ncontributions_scrape_commits_total 6\n"; !strings.Contains(string(b), want) {
+		t.Errorf("wrote\n%s\nwant it to hold %q", b, want)
+	}
+}
+
+func TestRunWritesCommitsCSV(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		dir := t.TempDir()
+		out := outputs{path: filepath.Join(dir, "out.csv"), opts: contrib.OutputOptions{Format: "csv"},
+			commits: filepath.Join(dir, "commits.csv"), stream: stream}
+		opts := savedRepo()
+		scraped := 0
+		opts.Progress = func(n, total int) { scraped = n }
+		if err := run(time.Minute, opts, nil, 1, nil, out); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(out.commits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(recs) != 1+scraped || scraped != 6 {
+			t.Errorf("stream %v: wrote %d rows of the %d commits scraped, want a header and a row each", stream,
+				len(recs)-1, scraped)
+			continue
+		}
+		if want := []string{"hash", "author", "committer", "date", "reviewers", "insertions", "deletions"}; !reflect.DeepEqual(recs[0], want) {
+			t.Errorf("stream %v: header = %q, want %q", stream, recs[0], want)
+		}
+		if !stream {
+			// the latest first
+			for i := 2; i < len(recs); i++ {
+				prev, _ := time.Parse(time.RFC3339, recs[i-1][3])
+				if d, _ := time.Parse(time.RFC3339, recs[i][3]); d.After(prev) {
+					t.Errorf("%s of %s comes after %s", recs[i][0], recs[i][3], recs[i-1][3])
+				}
+			}
+		}
+	}
+}
+
+func TestRunWritesCommitsAsCounted(t *testing.T) {
+	dir := t.TempDir()
+	out := outputs{path: filepath.Join(dir, "out.jsonl"), opts: contrib.OutputOptions{Format: "jsonl"},
+		commits: filepath.Join(dir, "commits.csv"), stream: true}
+	opts := savedRepo()
+	opts.CommitsPath = filepath.Join(dir, "commits")
+	lines := func(path string) int {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(b), "\n")
+	}
+	checked := 0
+	opts.Progress = func(n, total int) {
+		// what the n commits counted so far are, before the run completes
+		files, err := filepath.Glob(filepath.Join(opts.CommitsPath, "*.commit"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != n {
+			t.Errorf("%d commit files after %d commits", len(files), n)
+		}
+		if got := lines(out.path); got != n {
+			t.Errorf("%d jsonl lines after %d commits", got, n)
+		}
+		if got := lines(out.commits); got != 1+n {
+			t.Errorf("%d commits csv lines after %d commits, want a header and a row each", got, n)
+		}
+		checked++
+	}
+	if err := run(time.Minute, opts, nil, 1, nil, out); err != nil {
+		t.Fatal(err)
+	}
+	if checked != 6 {
+		t.Errorf("checked after %d commits, want the 6 saved", checked)
+	}
+}
+
+func TestRunRepos(t *testing.T) {
+	repos, err := loadRepos(filepath.Join("testdata", "repos.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 2 {
+		t.Fatalf("loaded repos %q, want the 2 listed", repos)
+	}
+	dir := t.TempDir()
+	out := outputs{path: filepath.Join(dir, "out.json"), opts: contrib.OutputOptions{Format: "json"},
+		commits: filepath.Join(dir, "commits.csv")}
+	if err = run(time.Minute, savedRepo(), repos, 2, nil, out); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(out.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []contrib.Contribution
+	if err = json.Unmarshal(b, &rows); err != nil {
+		t.Fatal(err)
+	}
+	byEmail := make(map[string]contrib.Contribution)
+	for _, r := range rows {
+		byEmail[r.Email] = r
+	}
+	// apoe created a commit in each, jdoe 2 of tast-tests and 1 of tast, and
+	// luci committed 4 of tast-tests and 1 of tast
+	if c := byEmail["apoe@google.com"]; c.Created != 2 || c.Reviewed != 2 {
+		t.Errorf("apoe: Created, Reviewed = %v, %d, want 2, 2", c.Created, c.Reviewed)
+	}
+	if c := byEmail["jdoe@chromium.org"]; c.Created != 3 || c.Committed != 2 {
+		t.Errorf("jdoe: Created, Committed = %v, %d, want 3, 2", c.Created, c.Committed)
+	}
+	if c := byEmail["chromeos-scoped@luci-project-accounts.iam.gserviceaccount.com"]; c.Committed != 5 {
+		t.Errorf("luci: Committed = %d, want 5", c.Committed)
+	}
+
+	f, err := os.Open(out.commits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	recs, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	perRepo := make(map[string]int)
+	for _, rec := range recs[1:] {
+		perRepo[rec[len(rec)-1]]++
+	}
+	if recs[0][len(recs[0])-1] != "repo" || perRepo[testRepo] != 6 ||
+		perRepo["https://chromium.googlesource.com/chromiumos/platform/tast"] != 2 {
+		t.Errorf("commits csv has header %q and rows per repo %v, want 6 of tast-tests and 2 of tast", recs[0], perRepo)
+	}
+}
+
+func TestRunResumesCommitLog(t *testing.T) {
+	dir := t.TempDir()
+	opts := savedRepo()
+	opts.HTMLDir = filepath.Join(dir, "pages")
+	if err := os.Mkdir(opts.HTMLDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(filepath.Join("testdata", "gitiles"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(filepath.Join("testdata", "gitiles", f.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, filepath.Join(opts.HTMLDir, f.Name()), string(b))
+	}
+	opts.Checkpoint = filepath.Join(dir, "checkpoint.json")
+	out := outputs{path: filepath.Join(dir, "out.jsonl"), opts: contrib.OutputOptions{Format: "jsonl", Summary: true}}
+
+	// the third commit is missing the first time
+	page := filepath.Join(opts.HTMLDir, "c3e5a7b9d1f2a4c6e8b0d2f4a6c8e0b2d4f6a8c9.html")
+	saved, err := ioutil.ReadFile(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(page); err != nil {
+		t.Fatal(err)
+	}
+	if err = run(time.Minute, opts, nil, 1, nil, out); err == nil {
+		t.Fatal("run without the page of c3e5 succeeded")
+	}
+
+	writeTestFile(t, page, string(saved))
+	stderr := capture(t, &os.Stderr, func() {
+		if err = run(time.Minute, opts, nil, 1, nil, out); err != nil {
+			t.Errorf("resumed run: %v", err)
+		}
+	})
+	b, err := ioutil.ReadFile(out.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "\n"); n != 6 {
+		t.Errorf("jsonl holds %d lines after resuming, want the 6 commits of both runs", n)
+	}
+	if want := ", 6 commits,"; !strings.Contains(stderr, want) {
+		t.Errorf("printed %q, want the commits of both runs counted: %q", stderr, want)
+	}
+}
+
+func TestParsePairs(t *testing.T) {
+	m, err := parsePairs([]string{"SID=a=b", " HSID = c ", "empty="}, "=")
+	if err != nil || !reflect.DeepEqual(m, map[string]string{"SID": "a=b", "HSID": "c", "empty": ""}) {
+		t.Errorf("parsePairs of cookies = %v, %v", m, err)
+	}
+	m, err = parsePairs([]string{"Authorization: Bearer x:y"}, ":")
+	if err != nil || m["Authorization"] != "Bearer x:y" {
+		t.Errorf("parsePairs of a header = %v, %v", m, err)
+	}
+	for _, s := range []string{"SID", "=a", " =a"} {
+		if _, err = parsePairs([]string{s}, "="); err == nil {
+			t.Errorf("parsePairs(%q) succeeded", s)
+		}
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		timeout   time.Duration
+		explicit  bool
+		perCommit time.Duration
+		count     int
+		want      time.Duration
+	}{
+		{"no budget per commit", 5 * time.Second, false, 0, 1000, 5 * time.Second},
+		{"budget per commit", 5 * time.Second, false, 2 * time.Second, 1000, 2000 * time.Second},
+		{"explicit timeout is shorter", time.Minute, true, 2 * time.Second, 1000, time.Minute},
+		{"explicit timeout is longer", time.Hour, true, 2 * time.Second, 1000, 2000 * time.Second},
+		{"no count", 5 * time.Second, false, 2 * time.Second, 0, 5 * time.Second},
+		{"default timeout is shorter", 5 * time.Second, false, 2 * time.Second, 1, 2 * time.Second},
+	} {
+		if got := runTimeout(tc.timeout, tc.explicit, tc.perCommit, tc.count); got != tc.want {
+			t.Errorf("%s: runTimeout = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCheckWritableDir(t *testing.T) {
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "out", "2021")
+	if err := checkWritableDir(dir); err != nil {
+		t.Fatalf("checkWritableDir of a missing directory: %v", err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("didn't create the directory: %v", err)
+	}
+	if len(files) > 0 {
+		t.Errorf("left %s behind", files[0].Name())
+	}
+
+	// a directory can't be made under a file, even by root
+	file := filepath.Join(tmp, "out.csv")
+	writeTestFile(t, file, "")
+	if err := checkWritableDir(filepath.Join(file, "commits")); err == nil {
+		t.Error("checkWritableDir under a file succeeded")
+	}
+	if err := checkWritableDir(file); err == nil {
+		t.Error("checkWritableDir of a file succeeded")
+	}
+
+	if os.Geteuid() == 0 {
+		t.Log("root writes to read-only directories, not checking them")
+		return
+	}
+	ro := filepath.Join(tmp, "ro")
+	if err := os.Mkdir(ro, 0555); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWritableDir(ro); err == nil {
+		t.Error("checkWritableDir of a read-only directory succeeded")
+	}
+}
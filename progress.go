@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// progress reports how many commits were scraped so far. On a terminal it
+// keeps rewriting a single line, elsewhere it prints a line per update so it
+// reads well in captured logs.
+type progress struct {
+	w       io.Writer
+	tty     bool
+	started bool
+}
+
+func newProgress(f *os.File) *progress {
+	fi, err := f.Stat()
+	return &progress{w: f, tty: err == nil && fi.Mode()&os.ModeCharDevice != 0}
+}
+
+func formatProgress(done, total int) string {
+	if total <= 0 {
+		return fmt.Sprintf("scraped %d commits", done)
+	}
+	return fmt.Sprintf("scraped %d/%d commits", done, total)
+}
+
+func (p *progress) update(done, total int) {
+	p.started = true
+	if p.tty {
+		fmt.Fprintf(p.w, "\r%s", formatProgress(done, total))
+	} else {
+		fmt.Fprintln(p.w, formatProgress(done, total))
+	}
+}
+
+// finish ends the line being rewritten on a terminal. It's a no-op on a nil
+// progress.
+func (p *progress) finish() {
+	if p != nil && p.tty && p.started {
+		fmt.Fprintln(p.w)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFormatProgress(t *testing.T) {
+	for _, tc := range []struct {
+		done, total int
+		want        string
+	}{
+		{42, 500, "scraped 42/500 commits"},
+		{0, 500, "scraped 0/500 commits"},
+		// no cnumber
+		{7, 0, "scraped 7 commits"},
+	} {
+		if got := formatProgress(tc.done, tc.total); got != tc.want {
+			t.Errorf("formatProgress(%d, %d) = %q, want %q", tc.done, tc.total, got, tc.want)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	for _, tc := range []struct {
+		tty  bool
+		want string
+	}{
+		{true, "\rscraped 1/2 commits\rscraped 2/2 commits\n"},
+		{false, "scraped 1/2 commits\nscraped 2/2 commits\n"},
+	} {
+		var buf bytes.Buffer
+		p := &progress{w: &buf, tty: tc.tty}
+		p.update(1, 2)
+		p.update(2, 2)
+		p.finish()
+		if got := buf.String(); got != tc.want {
+			t.Errorf("tty %v: wrote %q, want %q", tc.tty, got, tc.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	(&progress{w: &buf, tty: true}).finish()
+	if buf.Len() != 0 {
+		t.Errorf("finish without updates wrote %q", buf.String())
+	}
+}